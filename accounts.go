@@ -0,0 +1,242 @@
+package connected_drive
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultAccountParallelism = 4
+
+type AccountHealth struct {
+	Account             string    `json:"account"`
+	VehicleCount        int       `json:"vehicleCount"`
+	LastSuccessAt       time.Time `json:"lastSuccessAt"`
+	LastErrorAt         time.Time `json:"lastErrorAt"`
+	LastError           string    `json:"lastError,omitempty"`
+	ConsecutiveFailures int       `json:"consecutiveFailures"`
+}
+
+func (h AccountHealth) IsHealthy() bool {
+	return h.ConsecutiveFailures == 0 && !h.LastSuccessAt.IsZero()
+}
+
+type AccountErrors map[string]error
+
+func (e AccountErrors) Error() string {
+	names := make([]string, 0, len(e))
+	for name := range e {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	messages := make([]string, 0, len(names))
+	for _, name := range names {
+		messages = append(messages, fmt.Sprintf("%s: %v", name, e[name]))
+	}
+
+	return fmt.Sprintf("errors in %d account(s): %s", len(e), strings.Join(messages, "; "))
+}
+
+type AccountManager struct {
+	clients     map[string]*Client
+	accounts    []string
+	vins        map[string]string
+	health      map[string]*AccountHealth
+	parallelism int
+	mutex       *sync.RWMutex
+}
+
+func NewAccountManager(parallelism int) *AccountManager {
+	if parallelism <= 0 {
+		parallelism = defaultAccountParallelism
+	}
+
+	return &AccountManager{
+		clients:     make(map[string]*Client),
+		vins:        make(map[string]string),
+		health:      make(map[string]*AccountHealth),
+		parallelism: parallelism,
+		mutex:       &sync.RWMutex{},
+	}
+}
+
+func (m *AccountManager) AddAccount(name string, client *Client) error {
+	if name == "" || client == nil {
+		return fmt.Errorf("AddAccount error: account name and client are required")
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, ok := m.clients[name]; ok {
+		return fmt.Errorf("AddAccount error: account %q already exists", name)
+	}
+
+	m.clients[name] = client
+	m.accounts = append(m.accounts, name)
+	m.health[name] = &AccountHealth{Account: name}
+
+	return nil
+}
+
+func (m *AccountManager) RemoveAccount(name string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, ok := m.clients[name]; !ok {
+		return
+	}
+
+	delete(m.clients, name)
+	delete(m.health, name)
+	for i, account := range m.accounts {
+		if account == name {
+			m.accounts = append(m.accounts[:i], m.accounts[i+1:]...)
+
+			break
+		}
+	}
+	for vin, account := range m.vins {
+		if account == name {
+			delete(m.vins, vin)
+		}
+	}
+}
+
+func (m *AccountManager) Accounts() []string {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return append([]string(nil), m.accounts...)
+}
+
+// GetVehicles fetches vehicles of all accounts concurrently. Vehicles of healthy accounts are returned
+// even when some accounts fail; in that case err is AccountErrors keyed by account name.
+func (m *AccountManager) GetVehicles(ctx context.Context) (Vehicles, error) {
+	m.mutex.RLock()
+	accounts := append([]string(nil), m.accounts...)
+	clients := make([]*Client, len(accounts))
+	for i, account := range accounts {
+		clients[i] = m.clients[account]
+	}
+	m.mutex.RUnlock()
+
+	results := make([]Vehicles, len(accounts))
+	errs := make([]error, len(accounts))
+	semaphore := make(chan struct{}, m.parallelism)
+	wg := &sync.WaitGroup{}
+
+	for i := range accounts {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			select {
+			case semaphore <- struct{}{}:
+			case <-ctx.Done():
+				errs[i] = ctx.Err()
+
+				return
+			}
+			defer func() { <-semaphore }()
+
+			results[i], errs[i] = clients[i].GetVehicles(ctx)
+		}(i)
+	}
+	wg.Wait()
+
+	var vehicles Vehicles
+	accountErrors := AccountErrors{}
+	seen := make(map[string]bool)
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for i, account := range accounts {
+		health, ok := m.health[account]
+		if !ok {
+			// account was removed while fetching
+			continue
+		}
+
+		if errs[i] != nil {
+			accountErrors[account] = errs[i]
+			health.LastError = errs[i].Error()
+			health.LastErrorAt = time.Now()
+			health.ConsecutiveFailures++
+
+			continue
+		}
+
+		health.LastSuccessAt = time.Now()
+		health.ConsecutiveFailures = 0
+		health.VehicleCount = len(results[i])
+
+		// the VIN set of the account is rebuilt, so vehicles moved to another account or removed are
+		// no longer routed to it
+		for vin, owner := range m.vins {
+			if owner == account {
+				delete(m.vins, vin)
+			}
+		}
+		for _, v := range results[i] {
+			if v == nil || seen[v.Vin] {
+				continue
+			}
+
+			seen[v.Vin] = true
+			m.vins[v.Vin] = account
+			vehicles = append(vehicles, v)
+		}
+	}
+
+	if len(accountErrors) > 0 {
+		return vehicles, accountErrors
+	}
+
+	return vehicles, nil
+}
+
+// AccountForVin returns the account the vehicle was last seen in. VINs become known after GetVehicles.
+func (m *AccountManager) AccountForVin(vin string) (string, *Client, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	account, ok := m.vins[vin]
+	if !ok {
+		return "", nil, fmt.Errorf("AccountForVin error: vehicle %s is not known in any account", vin)
+	}
+
+	return account, m.clients[account], nil
+}
+
+// Do routes a command for the vehicle to the client of the account owning it.
+func (m *AccountManager) Do(ctx context.Context, vin string, command func(ctx context.Context, c *Client) error) error {
+	account, client, err := m.AccountForVin(vin)
+	if err != nil {
+		return err
+	}
+
+	err = command(ctx, client)
+	if err != nil {
+		return fmt.Errorf("command for %s in account %s failed: %w", vin, account, err)
+	}
+
+	return nil
+}
+
+func (m *AccountManager) Health() []AccountHealth {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	health := make([]AccountHealth, 0, len(m.accounts))
+	for _, account := range m.accounts {
+		health = append(health, *m.health[account])
+	}
+
+	return health
+}
@@ -0,0 +1,123 @@
+package connected_drive
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// tokenExpiryMargin refreshes tokens slightly before they expire so requests in flight don't fail.
+const tokenExpiryMargin = time.Minute
+
+var ErrInvalidTokenResponse = errors.New("token response does not contain an access token")
+
+type Token struct {
+	AccessToken  string `json:"access_token"`
+	Expires      int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	IdToken      string `json:"id_token"`
+	// ExpiresAt is the unix time the access token expires at, computed from Expires when the token is issued.
+	ExpiresAt int64 `json:"expires_at,omitempty"`
+}
+
+// Expired reports whether the access token has to be refreshed. Tokens stored without ExpiresAt are
+// considered expired.
+func (t *Token) Expired() bool {
+	return t.ExpiresAt == 0 || time.Now().Add(tokenExpiryMargin).Unix() >= t.ExpiresAt
+}
+
+// parseTokenResponse decodes a successful response of the token endpoint. Fields missing in a refresh
+// response, like a refresh token that wasn't rotated, are kept from previous.
+func parseTokenResponse(body []byte, previous *Token) (*Token, error) {
+	token := new(Token)
+	err := json.Unmarshal(body, token)
+	if err != nil {
+		return nil, fmt.Errorf("can't decode response: %w", err)
+	}
+	if token.AccessToken == "" {
+		return nil, ErrInvalidTokenResponse
+	}
+	if token.TokenType != "" && !strings.EqualFold(token.TokenType, "bearer") {
+		return nil, fmt.Errorf("unsupported token type %q", token.TokenType)
+	}
+
+	if previous != nil {
+		token.RefreshToken = firstNonEmpty(token.RefreshToken, previous.RefreshToken)
+		token.IdToken = firstNonEmpty(token.IdToken, previous.IdToken)
+	}
+	if token.Expires > 0 {
+		token.ExpiresAt = time.Now().Unix() + token.Expires
+	}
+
+	return token, nil
+}
+
+// isInvalidGrant reports whether the server rejected the refresh token itself, so that only a new login helps.
+func isInvalidGrant(err error) bool {
+	var authErr *AuthError
+
+	return errors.As(err, &authErr) && authErr.Code == "invalid_grant"
+}
+
+type Credentials struct {
+	Username     string
+	Password     string
+	CaptchaToken string
+}
+
+// Authenticator implements the login flow of an OAuth server. GcdmAuthenticator is used by default;
+// other implementations can be plugged in with WithAuthenticator for regions with a different flow.
+type Authenticator interface {
+	Login(ctx context.Context, credentials Credentials) (*Token, error)
+	Refresh(ctx context.Context, token *Token) (*Token, error)
+}
+
+// AuthError carries the error reported by the OAuth server for a stage of the login.
+type AuthError struct {
+	Stage       string
+	StatusCode  int
+	Code        string
+	Description string
+}
+
+func (e *AuthError) Error() string {
+	msg := fmt.Sprintf("%s error", e.Stage)
+	if e.Code != "" {
+		msg += ": " + e.Code
+	}
+	if e.Description != "" {
+		msg += ": " + e.Description
+	}
+	if e.StatusCode != 0 {
+		msg += fmt.Sprintf(" (status %d)", e.StatusCode)
+	}
+
+	return msg
+}
+
+func newAuthError(stage string, resp *http.Response, body []byte) *AuthError {
+	e := &AuthError{Stage: stage}
+	if resp != nil {
+		e.StatusCode = resp.StatusCode
+	}
+
+	var response struct {
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+		Message          string `json:"message"`
+	}
+	if json.Unmarshal(body, &response) == nil {
+		e.Code = response.Error
+		e.Description = firstNonEmpty(response.ErrorDescription, response.Message)
+	}
+	if e.Code == "" && e.Description == "" && resp != nil {
+		e.Description = http.StatusText(resp.StatusCode)
+	}
+
+	return e
+}
@@ -0,0 +1,212 @@
+package connected_drive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+type memoryTokenStore struct {
+	token   *Token
+	saveErr error
+	saves   int
+}
+
+func (s *memoryTokenStore) Load() (*Token, error) {
+	return s.token, nil
+}
+
+func (s *memoryTokenStore) Save(token *Token) error {
+	s.saves++
+	if s.saveErr != nil {
+		return s.saveErr
+	}
+	copied := *token
+	s.token = &copied
+
+	return nil
+}
+
+func (s *memoryTokenStore) Delete() error {
+	s.token = nil
+
+	return nil
+}
+
+// testGcdm configures the fake GCDM OAuth server of newTestGcdmServer. Refresh grants are answered with
+// refreshStatus and refreshBody; the login stages always succeed and return the idToken made for the nonce
+// sent with the login, if idToken is set.
+type testGcdm struct {
+	refreshStatus int
+	refreshBody   string
+	idToken       func(nonce string) string
+}
+
+func newTestGcdmServer(t *testing.T, config testGcdm) (*httptest.Server, *int) {
+	t.Helper()
+
+	logins := 0
+	nonce := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			t.Errorf("ParseForm: %v", err)
+		}
+
+		switch {
+		case r.URL.Path == "/auth" && r.PostForm.Get("username") != "":
+			nonce = r.PostForm.Get("nonce")
+			_, _ = fmt.Fprint(w, `{"redirect_to": "com.bmw.connected://oauth?authorization=test-authorization"}`)
+		case r.URL.Path == "/auth":
+			w.Header().Set("Location", gcdmRedirectUri+"?"+url.Values{
+				"code":  {"test-code"},
+				"state": {r.PostForm.Get("state")},
+			}.Encode())
+			w.WriteHeader(http.StatusFound)
+		case r.URL.Path == "/token" && r.PostForm.Get("grant_type") == "authorization_code":
+			logins++
+			idToken := ""
+			if config.idToken != nil {
+				idToken = config.idToken(nonce)
+			}
+			_, _ = fmt.Fprintf(
+				w,
+				`{"access_token": "login-access", "refresh_token": "login-refresh", "id_token": %q, "expires_in": 3600, "token_type": "Bearer"}`,
+				idToken,
+			)
+		case r.URL.Path == "/token" && r.PostForm.Get("grant_type") == "refresh_token":
+			if got := r.PostForm.Get("refresh_token"); got != "old-refresh" {
+				t.Errorf("refreshed with %q", got)
+			}
+			w.WriteHeader(config.refreshStatus)
+			_, _ = fmt.Fprint(w, config.refreshBody)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return server, &logins
+}
+
+func TestRefreshAuth(t *testing.T) {
+	expired := &Token{
+		AccessToken:  "old-access",
+		RefreshToken: "old-refresh",
+		ExpiresAt:    time.Now().Add(-time.Hour).Unix(),
+	}
+
+	tests := []struct {
+		name          string
+		refreshStatus int
+		refreshBody   string
+		saveErr       error
+		wantErr       bool
+		wantLogins    int
+		wantAccess    string
+		wantRefresh   string
+		wantStored    string
+	}{
+		{
+			name:          "refresh keeps the refresh token",
+			refreshStatus: http.StatusOK,
+			refreshBody:   `{"access_token": "new-access", "expires_in": 3600, "token_type": "Bearer"}`,
+			wantAccess:    "new-access",
+			wantRefresh:   "old-refresh",
+			wantStored:    "new-access",
+		},
+		{
+			name:          "refresh rotates the refresh token",
+			refreshStatus: http.StatusOK,
+			refreshBody:   `{"access_token": "new-access", "refresh_token": "new-refresh", "expires_in": 3600}`,
+			wantAccess:    "new-access",
+			wantRefresh:   "new-refresh",
+			wantStored:    "new-access",
+		},
+		{
+			name:          "invalid grant logs in again",
+			refreshStatus: http.StatusBadRequest,
+			refreshBody:   `{"error": "invalid_grant", "error_description": "refresh token expired"}`,
+			wantLogins:    1,
+			wantAccess:    "login-access",
+			wantRefresh:   "login-refresh",
+			wantStored:    "login-access",
+		},
+		{
+			name:          "other errors keep the old tokens",
+			refreshStatus: http.StatusServiceUnavailable,
+			refreshBody:   `{"error": "temporarily_unavailable"}`,
+			wantErr:       true,
+			wantAccess:    "old-access",
+			wantRefresh:   "old-refresh",
+			wantStored:    "old-access",
+		},
+		{
+			name:          "failed save keeps the new tokens",
+			refreshStatus: http.StatusOK,
+			refreshBody:   `{"access_token": "new-access", "refresh_token": "new-refresh", "expires_in": 3600}`,
+			saveErr:       errors.New("disk full"),
+			wantAccess:    "new-access",
+			wantRefresh:   "new-refresh",
+			wantStored:    "old-access",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, logins := newTestGcdmServer(t, testGcdm{refreshStatus: tt.refreshStatus, refreshBody: tt.refreshBody})
+			gcdm := NewGcdmAuthenticator(server.Client())
+			gcdm.AuthUrl = server.URL + "/auth"
+			gcdm.TokenUrl = server.URL + "/token"
+
+			stored := *expired
+			store := &memoryTokenStore{token: &stored, saveErr: tt.saveErr}
+			c := NewClient("user@example.com", "password", nil, server.Client(),
+				WithTokenStore(store), WithAuthenticator(gcdm))
+
+			err := c.refreshAuth(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("refreshAuth error %v, want error %v", err, tt.wantErr)
+			}
+			if *logins != tt.wantLogins {
+				t.Errorf("%d logins, want %d", *logins, tt.wantLogins)
+			}
+			if c.auth.AccessToken != tt.wantAccess || c.auth.RefreshToken != tt.wantRefresh {
+				t.Errorf("client holds %q/%q, want %q/%q",
+					c.auth.AccessToken, c.auth.RefreshToken, tt.wantAccess, tt.wantRefresh)
+			}
+			if store.token.AccessToken != tt.wantStored {
+				t.Errorf("store holds %q, want %q", store.token.AccessToken, tt.wantStored)
+			}
+			if tt.saveErr == nil && store.token.RefreshToken != tt.wantRefresh {
+				t.Errorf("store holds refresh token %q, want %q", store.token.RefreshToken, tt.wantRefresh)
+			}
+			if c.authUnsaved != (tt.saveErr != nil) {
+				t.Errorf("authUnsaved %v", c.authUnsaved)
+			}
+
+			if tt.saveErr == nil {
+				return
+			}
+
+			// the next request retries the save without refreshing again
+			store.saveErr = nil
+			err = c.refreshAuth(context.Background())
+			if err != nil {
+				t.Fatalf("refreshAuth after failed save: %v", err)
+			}
+			if store.token.RefreshToken != tt.wantRefresh || c.authUnsaved {
+				t.Errorf("save not retried: store holds %+v", store.token)
+			}
+			if store.saves != 2 {
+				t.Errorf("%d saves, want 2", store.saves)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package connected_drive
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+const captchaTokenHeader = "hcaptchatoken"
+
+var ErrCaptchaRequired = errors.New("captcha required")
+
+type CaptchaChallenge struct {
+	StatusCode int    `json:"statusCode"`
+	SiteKey    string `json:"siteKey,omitempty"`
+	Message    string `json:"message,omitempty"`
+}
+
+// CaptchaError is returned when the login requires a captcha token that could not be provided.
+// It matches ErrCaptchaRequired with errors.Is.
+type CaptchaError struct {
+	Challenge CaptchaChallenge
+}
+
+func (e *CaptchaError) Error() string {
+	if e.Challenge.Message != "" {
+		return ErrCaptchaRequired.Error() + ": " + e.Challenge.Message
+	}
+
+	return ErrCaptchaRequired.Error()
+}
+
+func (e *CaptchaError) Is(target error) bool {
+	return target == ErrCaptchaRequired
+}
+
+// CaptchaSolver obtains a captcha token, e.g. by showing the captcha to the user.
+type CaptchaSolver interface {
+	SolveCaptcha(ctx context.Context, challenge CaptchaChallenge) (string, error)
+}
+
+type CaptchaSolverFunc func(ctx context.Context, challenge CaptchaChallenge) (string, error)
+
+func (f CaptchaSolverFunc) SolveCaptcha(ctx context.Context, challenge CaptchaChallenge) (string, error) {
+	return f(ctx, challenge)
+}
+
+// WithCaptchaToken sets a captcha token for the next login. Tokens are single use and are dropped after
+// the login attempt.
+func WithCaptchaToken(token string) ClientOption {
+	return func(c *Client) {
+		c.captchaToken = token
+	}
+}
+
+// WithCaptchaSolver sets the solver of the default authenticator. Custom authenticators are configured directly.
+func WithCaptchaSolver(solver CaptchaSolver) ClientOption {
+	return func(c *Client) {
+		c.captchaSolver = solver
+	}
+}
+
+// SetCaptchaToken sets a captcha token for the next login of an existing client.
+func (c *Client) SetCaptchaToken(token string) {
+	c.authMutex.Lock()
+	defer c.authMutex.Unlock()
+
+	c.captchaToken = token
+}
+
+// takeCaptchaToken must be called with authMutex held.
+func (c *Client) takeCaptchaToken() string {
+	token := c.captchaToken
+	c.captchaToken = ""
+
+	return token
+}
+
+// captchaErrorCodes are the error codes the authenticate endpoint answers with when a captcha token is
+// missing or was rejected.
+var captchaErrorCodes = map[string]bool{
+	"captcha_required":       true,
+	"hcaptcha_required":      true,
+	"invalid_captcha":        true,
+	"invalid_hcaptcha_token": true,
+}
+
+// isCaptchaResponse reports whether a failed authenticate request asks for a captcha: the response is a client
+// error and its JSON error names a captcha, carries a captcha site key or describes a missing captcha token.
+func isCaptchaResponse(statusCode int, body []byte) bool {
+	switch statusCode {
+	case http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusUnprocessableEntity:
+	default:
+		return false
+	}
+
+	var response struct {
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+		Message          string `json:"message"`
+		SiteKey          string `json:"sitekey"`
+		HCaptchaSiteKey  string `json:"hcaptchaSiteKey"`
+	}
+	if json.Unmarshal(body, &response) != nil {
+		return false
+	}
+	if captchaErrorCodes[strings.ToLower(response.Error)] || response.SiteKey != "" || response.HCaptchaSiteKey != "" {
+		return true
+	}
+
+	description := strings.ToLower(firstNonEmpty(response.ErrorDescription, response.Message))
+
+	return strings.Contains(description, "captcha") && strings.Contains(description, "token")
+}
+
+func newCaptchaChallenge(statusCode int, body []byte) CaptchaChallenge {
+	challenge := CaptchaChallenge{StatusCode: statusCode}
+
+	var response struct {
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+		Message          string `json:"message"`
+		SiteKey          string `json:"sitekey"`
+		HCaptchaSiteKey  string `json:"hcaptchaSiteKey"`
+	}
+	if json.Unmarshal(body, &response) == nil {
+		challenge.SiteKey = firstNonEmpty(response.SiteKey, response.HCaptchaSiteKey)
+		challenge.Message = firstNonEmpty(response.ErrorDescription, response.Message, response.Error)
+	}
+
+	return challenge
+}
@@ -0,0 +1,28 @@
+package connected_drive
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestIsCaptchaResponse(t *testing.T) {
+	tests := []struct {
+		status int
+		body   string
+		want   bool
+	}{
+		{http.StatusBadRequest, `{"error": "captcha_required"}`, true},
+		{http.StatusForbidden, `{"error": "access_denied", "sitekey": "10000000-ffff-ffff-ffff-000000000001"}`, true},
+		{http.StatusUnprocessableEntity, `{"error": "invalid_request", "error_description": "Missing hCaptcha token"}`, true},
+		{http.StatusUnauthorized, `{"error": "invalid_client", "error_description": "client may not use captcha"}`, false},
+		{http.StatusBadRequest, `{"error": "invalid_grant", "error_description": "wrong password"}`, false},
+		{http.StatusBadRequest, `<html>see https://example.com/captcha-help</html>`, false},
+		{http.StatusInternalServerError, `{"error": "captcha_required"}`, false},
+	}
+
+	for _, tt := range tests {
+		if got := isCaptchaResponse(tt.status, []byte(tt.body)); got != tt.want {
+			t.Errorf("isCaptchaResponse(%d, %s) = %v, want %v", tt.status, tt.body, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package connected_drive
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+type Severity string
+
+const (
+	SeverityOk     Severity = "OK"
+	SeverityLow    Severity = "LOW"
+	SeverityMedium Severity = "MEDIUM"
+	SeverityHigh   Severity = "HIGH"
+)
+
+var severities = []string{string(SeverityOk), string(SeverityLow), string(SeverityMedium), string(SeverityHigh)}
+
+func (s *Severity) UnmarshalJSON(b []byte) error {
+	*s = Severity(unmarshalEnum(b, severities))
+
+	return nil
+}
+
+func (s Severity) IsKnown() bool {
+	return isKnownEnum(string(s), severities)
+}
+
+// Level orders severities: 0 for unknown, 1 for OK and up to 4 for HIGH.
+func (s Severity) Level() int {
+	for i, known := range severities {
+		if string(s) == known {
+			return i + 1
+		}
+	}
+
+	return 0
+}
+
+func (c Criticalness) Severity() Severity {
+	switch c {
+	case CriticalnessNonCritical:
+		return SeverityOk
+	case CriticalnessSemiCritical:
+		return SeverityMedium
+	case CriticalnessCritical:
+		return SeverityHigh
+	}
+
+	return Severity(c)
+}
+
+type CheckControlCategory string
+
+const (
+	CategoryTyrePressure CheckControlCategory = "TYRE_PRESSURE"
+	CategoryOil          CheckControlCategory = "OIL"
+	CategoryBrake        CheckControlCategory = "BRAKE"
+	CategoryEngine       CheckControlCategory = "ENGINE"
+	CategoryOther        CheckControlCategory = "OTHER"
+)
+
+// CheckControlCatalogue maps known check-control codes onto categories. Codes missing here are
+// categorised by keywords in the code and title.
+var CheckControlCatalogue = map[string]CheckControlCategory{
+	"TIRE_PRESSURE":      CategoryTyrePressure,
+	"TYRE_PRESSURE":      CategoryTyrePressure,
+	"TIRE_PRESSURE_LOW":  CategoryTyrePressure,
+	"FLAT_TIRE_WARNING":  CategoryTyrePressure,
+	"ENGINE_OIL":         CategoryOil,
+	"ENGINE_OIL_LEVEL":   CategoryOil,
+	"OIL_LEVEL":          CategoryOil,
+	"OIL_PRESSURE":       CategoryOil,
+	"BRAKE_FLUID":        CategoryBrake,
+	"BRAKE_PADS_FRONT":   CategoryBrake,
+	"BRAKE_PADS_REAR":    CategoryBrake,
+	"BRAKE_SYSTEM":       CategoryBrake,
+	"PARKING_BRAKE":      CategoryBrake,
+	"ENGINE_MALFUNCTION": CategoryEngine,
+	"ENGINE_COOLANT":     CategoryEngine,
+	"ENGINE_TEMPERATURE": CategoryEngine,
+	"DRIVETRAIN":         CategoryEngine,
+}
+
+var checkControlKeywords = []struct {
+	keyword  string
+	category CheckControlCategory
+}{
+	{"TIRE", CategoryTyrePressure},
+	{"TYRE", CategoryTyrePressure},
+	{"OIL", CategoryOil},
+	{"BRAKE", CategoryBrake},
+	{"ENGINE", CategoryEngine},
+	{"DRIVETRAIN", CategoryEngine},
+}
+
+type CheckControlMessage struct {
+	Id          string    `json:"id"`
+	Code        string    `json:"type"`
+	Severity    Severity  `json:"severity"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	Timestamp   time.Time `json:"dateTime"`
+}
+
+// UnmarshalJSON accepts both the field names of the vehicle properties and the older
+// name/longDescription/ccmId variants. Like recalls, it never fails on unexpected field types or date formats,
+// so that a single odd message can't break decoding of the whole vehicles list.
+func (m *CheckControlMessage) UnmarshalJSON(b []byte) error {
+	var raw struct {
+		Id              json.RawMessage `json:"id"`
+		CcmId           json.RawMessage `json:"ccmId"`
+		Type            json.RawMessage `json:"type"`
+		Code            json.RawMessage `json:"code"`
+		Severity        Severity        `json:"severity"`
+		Title           json.RawMessage `json:"title"`
+		Name            json.RawMessage `json:"name"`
+		Description     json.RawMessage `json:"description"`
+		LongDescription json.RawMessage `json:"longDescription"`
+		DateTime        json.RawMessage `json:"dateTime"`
+		Timestamp       json.RawMessage `json:"timestamp"`
+	}
+	err := json.Unmarshal(b, &raw)
+	if err != nil {
+		*m = CheckControlMessage{Title: rawString(b)}
+
+		return nil
+	}
+
+	*m = CheckControlMessage{
+		Id:          firstNonEmpty(rawString(raw.Id), rawString(raw.CcmId)),
+		Code:        firstNonEmpty(rawString(raw.Type), rawString(raw.Code)),
+		Severity:    raw.Severity,
+		Title:       firstNonEmpty(rawString(raw.Title), rawString(raw.Name)),
+		Description: firstNonEmpty(rawString(raw.Description), rawString(raw.LongDescription)),
+	}
+	for _, d := range []json.RawMessage{raw.DateTime, raw.Timestamp} {
+		t, err := parseRecallDate(rawString(d))
+		if err == nil && !t.IsZero() {
+			m.Timestamp = t
+
+			break
+		}
+	}
+
+	return nil
+}
+
+// CheckControlMessages ignores a message list that is not an array instead of failing the vehicle.
+type CheckControlMessages []CheckControlMessage
+
+func (ms *CheckControlMessages) UnmarshalJSON(b []byte) error {
+	var messages []CheckControlMessage
+	if json.Unmarshal(b, &messages) != nil {
+		messages = nil
+	}
+	*ms = messages
+
+	return nil
+}
+
+func (m CheckControlMessage) Category() CheckControlCategory {
+	code := strings.ToUpper(strings.TrimSpace(m.Code))
+	if category, ok := CheckControlCatalogue[code]; ok {
+		return category
+	}
+
+	for _, text := range []string{code, strings.ToUpper(m.Title)} {
+		for _, k := range checkControlKeywords {
+			if strings.Contains(text, k.keyword) {
+				return k.category
+			}
+		}
+	}
+
+	return CategoryOther
+}
+
+// CheckControlMessages merges the structured messages from the vehicle properties with the display
+// messages from the vehicle status. A status message is merged into a property message with the same
+// title or, as property messages usually carry no title, into one of the same category.
+func (v *Vehicle) CheckControlMessages() []CheckControlMessage {
+	messages := append([]CheckControlMessage(nil), v.Properties.CheckControlMessages...)
+	merged := make([]bool, len(messages))
+
+	for _, s := range v.Status.CheckControlMessages {
+		status := CheckControlMessage{
+			Severity:    s.Criticalness.Severity(),
+			Title:       s.Title,
+			Description: s.State,
+			Timestamp:   v.Status.LastUpdatedAt,
+		}
+
+		match := -1
+		for i, m := range messages[:len(merged)] {
+			if merged[i] {
+				continue
+			}
+			if status.Title != "" && strings.EqualFold(m.Title, status.Title) {
+				match = i
+
+				break
+			}
+			if match < 0 && m.Title == "" && isSameWarning(m, status) {
+				match = i
+			}
+		}
+
+		if match < 0 {
+			messages = append(messages, status)
+
+			continue
+		}
+
+		m := &messages[match]
+		merged[match] = true
+		m.Title = firstNonEmpty(m.Title, status.Title)
+		if m.Severity == "" {
+			m.Severity = status.Severity
+		}
+		if m.Description == "" {
+			m.Description = status.Description
+		}
+	}
+
+	return messages
+}
+
+// isSameWarning reports whether a property message without a title describes the same warning as a status
+// message, that is whether the status title falls into the known category of the message code.
+func isSameWarning(property, status CheckControlMessage) bool {
+	category := property.Category()
+
+	return category != CategoryOther && category == status.Category()
+}
+
+// Warnings returns the messages of at least the given severity. Messages with an unrecognised severity are
+// always returned, as it's unknown how serious they are.
+func (v *Vehicle) Warnings(minSeverity Severity) []CheckControlMessage {
+	var warnings []CheckControlMessage
+	for _, m := range v.CheckControlMessages() {
+		if !m.Severity.IsKnown() || m.Severity.Level() >= minSeverity.Level() {
+			warnings = append(warnings, m)
+		}
+	}
+
+	return warnings
+}
+
+func rawString(raw json.RawMessage) string {
+	if len(raw) == 0 || string(raw) == "null" {
+		return ""
+	}
+
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+
+	return string(raw)
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+
+	return ""
+}
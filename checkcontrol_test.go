@@ -0,0 +1,89 @@
+package connected_drive
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestCheckControlMessagesDecodeTolerantly(t *testing.T) {
+	var v Vehicle
+	err := json.Unmarshal([]byte(`{
+		"properties": {
+			"checkControlMessages": [
+				{"type": 42, "severity": {"level": 3}, "title": "Odd", "dateTime": "yesterday"},
+				{"type": "ENGINE_OIL", "severity": "LOW", "dateTime": "2024-05-01T10:00:00Z"},
+				"just a string"
+			]
+		}
+	}`), &v)
+	if err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+
+	messages := v.Properties.CheckControlMessages
+	if len(messages) != 3 {
+		t.Fatalf("got %d messages, want 3", len(messages))
+	}
+	if messages[0].Code != "42" || messages[0].Severity.IsKnown() || !messages[0].Timestamp.IsZero() {
+		t.Errorf("odd message decoded as %+v", messages[0])
+	}
+	if messages[1].Code != "ENGINE_OIL" || messages[1].Severity != SeverityLow || messages[1].Timestamp.IsZero() {
+		t.Errorf("oil message decoded as %+v", messages[1])
+	}
+	if messages[2].Title != "just a string" {
+		t.Errorf("string message decoded as %+v", messages[2])
+	}
+
+	err = json.Unmarshal([]byte(`{"properties": {"checkControlMessages": {"unexpected": true}}}`), &v)
+	if err != nil || len(v.Properties.CheckControlMessages) != 0 {
+		t.Errorf("non-array messages: %v, %v", err, v.Properties.CheckControlMessages)
+	}
+}
+
+func TestCheckControlMessagesMergeAndWarnings(t *testing.T) {
+	var v Vehicle
+	err := json.Unmarshal([]byte(`{
+		"properties": {
+			"checkControlMessages": [
+				{"type": "ENGINE_OIL", "severity": "LOW"},
+				{"type": "TIRE_PRESSURE", "severity": "HIGH"},
+				{"type": "WASHER_FLUID", "severity": "SOMETHING_NEW"}
+			]
+		},
+		"status": {
+			"checkControlMessages": [
+				{"title": "Engine oil level", "state": "Top up at the next stop", "criticalness": "semiCritical"},
+				{"title": "Tyre pressure", "state": "Check tyres", "criticalness": "critical"},
+				{"title": "Lights", "state": "Bulb failure", "criticalness": "nonCritical"}
+			]
+		}
+	}`), &v)
+	if err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+
+	messages := v.CheckControlMessages()
+	byCode := map[string]CheckControlMessage{}
+	for _, m := range messages {
+		byCode[m.Code] = m
+	}
+
+	if len(messages) != 4 {
+		t.Fatalf("got %d messages, want 4: %+v", len(messages), messages)
+	}
+	if oil := byCode["ENGINE_OIL"]; oil.Title != "Engine oil level" || oil.Severity != SeverityLow {
+		t.Errorf("oil messages not merged: %+v", oil)
+	}
+	if tyre := byCode["TIRE_PRESSURE"]; tyre.Title != "Tyre pressure" || tyre.Description != "Check tyres" {
+		t.Errorf("tyre messages not merged: %+v", tyre)
+	}
+
+	warnings := v.Warnings(SeverityHigh)
+	codes := map[string]bool{}
+	for _, w := range warnings {
+		codes[w.Code] = true
+	}
+	if len(warnings) != 2 || !codes["TIRE_PRESSURE"] || !codes["WASHER_FLUID"] {
+		t.Errorf("got warnings %+v, want the tyre pressure and the unrecognised one", warnings)
+	}
+}
@@ -2,15 +2,10 @@ package connected_drive
 
 import (
 	"context"
-	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
-	"math/rand"
 	"net/http"
-	"net/url"
-	"regexp"
-	"strings"
 	"sync"
 	"time"
 )
@@ -27,14 +22,6 @@ const (
 	contentTypeJson       = "application/json; charset=UTF-8"
 )
 
-type auth struct {
-	Token        string `json:"access_token"`
-	Expires      int64  `json:"expires_in"`
-	RefreshToken string `json:"refresh_token"`
-	TokenType    string `json:"token_type"`
-	IdToken      string `json:"id_token"`
-}
-
 type Vehicle struct {
 	Vin            string `json:"vin"`
 	Model          string `json:"model"`
@@ -155,41 +142,33 @@ type Vehicle struct {
 		AreWindowsClosed bool      `json:"areWindowsClosed"`
 		DoorsAndWindows  struct {
 			Doors struct {
-				DriverFront    string `json:"driverFront"`
-				DriverRear     string `json:"driverRear"`
-				PassengerFront string `json:"passengerFront"`
-				PassengerRear  string `json:"passengerRear"`
+				DriverFront    DoorState `json:"driverFront"`
+				DriverRear     DoorState `json:"driverRear"`
+				PassengerFront DoorState `json:"passengerFront"`
+				PassengerRear  DoorState `json:"passengerRear"`
 			} `json:"doors"`
 			Windows struct {
-				DriverFront    string `json:"driverFront"`
-				DriverRear     string `json:"driverRear"`
-				PassengerFront string `json:"passengerFront"`
-				PassengerRear  string `json:"passengerRear"`
+				DriverFront    WindowState `json:"driverFront"`
+				DriverRear     WindowState `json:"driverRear"`
+				PassengerFront WindowState `json:"passengerFront"`
+				PassengerRear  WindowState `json:"passengerRear"`
 			} `json:"windows"`
-			Trunk string `json:"trunk"`
-			Hood  string `json:"hood"`
+			Trunk DoorState `json:"trunk"`
+			Hood  DoorState `json:"hood"`
 		} `json:"doorsAndWindows"`
-		IsServiceRequired bool `json:"isServiceRequired"`
-		FuelLevel         struct {
-			Value int    `json:"value"`
-			Units string `json:"units"`
-		} `json:"fuelLevel"`
-		CombustionRange struct {
-			Distance struct {
-				Value int    `json:"value"`
-				Units string `json:"units"`
-			} `json:"distance"`
+		IsServiceRequired bool   `json:"isServiceRequired"`
+		FuelLevel         Volume `json:"fuelLevel"`
+		CombustionRange   struct {
+			Distance Distance `json:"distance"`
 		} `json:"combustionRange"`
-		CheckControlMessages []interface{} `json:"checkControlMessages"`
+		CheckControlMessages CheckControlMessages `json:"checkControlMessages"`
 		ServiceRequired      []struct {
 			Type     string    `json:"type"`
 			Status   string    `json:"status"`
 			DateTime time.Time `json:"dateTime"`
-			Distance struct {
-				Value int    `json:"value"`
-				Units string `json:"units"`
-			} `json:"distance,omitempty"`
+			Distance *Distance `json:"distance,omitempty"`
 		} `json:"serviceRequired"`
+		Tires           Tires `json:"tires"`
 		VehicleLocation struct {
 			Coordinates struct {
 				Latitude  float64 `json:"latitude"`
@@ -221,37 +200,33 @@ type Vehicle struct {
 	} `json:"themeSpecs"`
 	Status struct {
 		LastUpdatedAt  time.Time `json:"lastUpdatedAt"`
-		CurrentMileage struct {
-			Mileage          int    `json:"mileage"`
-			Units            string `json:"units"`
-			FormattedMileage string `json:"formattedMileage"`
-		} `json:"currentMileage"`
-		Issues struct {
+		CurrentMileage Mileage   `json:"currentMileage"`
+		Issues         struct {
 		} `json:"issues"`
-		DoorsGeneralState                string `json:"doorsGeneralState"`
-		CheckControlMessagesGeneralState string `json:"checkControlMessagesGeneralState"`
+		DoorsGeneralState                LockState `json:"doorsGeneralState"`
+		CheckControlMessagesGeneralState string    `json:"checkControlMessagesGeneralState"`
 		DoorsAndWindows                  []struct {
-			IconId       int    `json:"iconId"`
-			Title        string `json:"title"`
-			State        string `json:"state"`
-			Criticalness string `json:"criticalness"`
+			IconId       int          `json:"iconId"`
+			Title        string       `json:"title"`
+			State        string       `json:"state"`
+			Criticalness Criticalness `json:"criticalness"`
 		} `json:"doorsAndWindows"`
 		CheckControlMessages []struct {
-			Criticalness string `json:"criticalness"`
-			IconId       int    `json:"iconId"`
-			Title        string `json:"title"`
-			State        string `json:"state"`
+			Criticalness Criticalness `json:"criticalness"`
+			IconId       int          `json:"iconId"`
+			Title        string       `json:"title"`
+			State        string       `json:"state"`
 		} `json:"checkControlMessages"`
 		RequiredServices []struct {
-			Id              string `json:"id"`
-			Title           string `json:"title"`
-			IconId          int    `json:"iconId"`
-			LongDescription string `json:"longDescription"`
-			Subtitle        string `json:"subtitle"`
-			Criticalness    string `json:"criticalness"`
+			Id              string       `json:"id"`
+			Title           string       `json:"title"`
+			IconId          int          `json:"iconId"`
+			LongDescription string       `json:"longDescription"`
+			Subtitle        string       `json:"subtitle"`
+			Criticalness    Criticalness `json:"criticalness"`
 		} `json:"requiredServices"`
-		RecallMessages    []interface{} `json:"recallMessages"`
-		RecallExternalUrl interface{}   `json:"recallExternalUrl"`
+		RecallMessages    RecallMessages `json:"recallMessages"`
+		RecallExternalUrl RecallUrl      `json:"recallExternalUrl"`
 		FuelIndicators    []struct {
 			SecondaryBarValue int         `json:"secondaryBarValue"`
 			InfoIconId        int         `json:"infoIconId"`
@@ -280,27 +255,80 @@ type Vehicles []*Vehicle
 type Client struct {
 	username   string
 	password   string
-	authStore  io.ReadWriter
-	auth       *auth
+	authStore  TokenStore
+	auth       *Token
 	httpClient *http.Client
 	authMutex  *sync.Mutex
+	unitSystem UnitSystem
+
+	imageCacheDir string
+	captchaToken  string
+	captchaSolver CaptchaSolver
+	authenticator Authenticator
+
+	idTokenVerifier *IdTokenVerifier
+	logger          Logger
+	logVins         bool
+	tracer          Tracer
+	meter           Meter
+	// authUnsaved is set when the token store failed to save rotated tokens, saving is retried on the next request
+	authUnsaved bool
+}
+
+type ClientOption func(c *Client)
+
+func WithAuthenticator(authenticator Authenticator) ClientOption {
+	return func(c *Client) {
+		c.authenticator = authenticator
+	}
+}
+
+func WithUnitSystem(system UnitSystem) ClientOption {
+	return func(c *Client) {
+		c.unitSystem = system
+	}
 }
 
-func NewClient(username string, password string, authStore io.ReadWriter, httpClient *http.Client) *Client {
+func NewClient(
+	username string,
+	password string,
+	authStore io.ReadWriter,
+	httpClient *http.Client,
+	opts ...ClientOption,
+) *Client {
 	httpClient.CheckRedirect = func(_ *http.Request, _ []*http.Request) error {
 		return http.ErrUseLastResponse
 	}
 
-	return &Client{
+	c := &Client{
 		username:   username,
 		password:   password,
-		authStore:  authStore,
 		httpClient: httpClient,
 		authMutex:  &sync.Mutex{},
 	}
+	if authStore != nil {
+		c.authStore = newReadWriterTokenStore(authStore)
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.logger = newRedactingLogger(c.logger, c.logVins)
+	if c.authenticator == nil {
+		gcdm := NewGcdmAuthenticator(httpClient)
+		gcdm.CaptchaSolver = c.captchaSolver
+		gcdm.Logger = c.logger
+		gcdm.Tracer = c.tracer
+		gcdm.Meter = c.meter
+		c.authenticator = gcdm
+	}
+
+	return c
 }
 
 func (c *Client) GetVehicles(ctx context.Context) (vehicles Vehicles, err error) {
+	ctx, op := c.startOperation(ctx, "GetVehicles")
+	defer func() { op.end(err) }()
+
 	err = c.refreshAuth(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("error refreshing auth while fetching vehicles list: %w", err)
@@ -313,13 +341,13 @@ func (c *Client) GetVehicles(ctx context.Context) (vehicles Vehicles, err error)
 		fmt.Sprintf(vehiclesRequestUrl, offset, time.Now().Unix()),
 		nil,
 	)
-	req.Header = http.Header{
-		"x-user-agent":  {androidUserAgent},
-		"Authorization": {fmt.Sprintf("Bearer %s", c.auth.Token)},
-		"Content-Type":  {contentTypeJson},
+	if err != nil {
+		return nil, fmt.Errorf("error creating vehicles list request: %w", err)
 	}
 
-	resp, err := c.httpClient.Do(req)
+	req.Header = c.apiHeader()
+
+	resp, err := c.do(req)
 	if err != nil {
 		return nil, fmt.Errorf("error fetching vehicles list: %w", err)
 	}
@@ -334,19 +362,88 @@ func (c *Client) GetVehicles(ctx context.Context) (vehicles Vehicles, err error)
 		return nil, fmt.Errorf("error decoding vehicles list: %w, %v", err, resp)
 	}
 
+	for _, v := range vehicles {
+		v.NormalizeUnits(c.unitSystem)
+	}
+	op.span.SetAttributes(Attr("connecteddrive.vehicle_count", len(vehicles)))
+
 	return vehicles, nil
 }
 
-func (c *Client) saveAuth() {
+// do sends a request to the API and logs it.
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	ctx, op := newInstrumentation(c.tracer, c.meter).start(
+		req.Context(),
+		"HTTP "+req.Method,
+		MetricHttpDuration,
+		Attr(AttrHttpMethod, req.Method),
+		Attr(AttrEndpoint, endpoint(req)),
+	)
+	req = req.WithContext(ctx)
+
+	start := time.Now()
+	c.log(req.Context(), LogLevelDebug, "API request", "method", req.Method, "url", logUrl(req.URL))
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		op.end(err)
+		c.log(
+			req.Context(),
+			LogLevelWarn,
+			"API request failed",
+			"method", req.Method,
+			"url", logUrl(req.URL),
+			"error", err,
+			"duration", time.Since(start),
+		)
+
+		return nil, err
+	}
+
+	op.setAttributes(Attr(AttrStatusCode, resp.StatusCode))
+	level := LogLevelDebug
+	if resp.StatusCode >= http.StatusBadRequest {
+		level = LogLevelWarn
+		op.end(fmt.Errorf("status %d", resp.StatusCode))
+	} else {
+		op.end(nil)
+	}
+	c.log(
+		req.Context(),
+		level,
+		"API response",
+		"method", req.Method,
+		"url", logUrl(req.URL),
+		"status", resp.StatusCode,
+		"duration", time.Since(start),
+	)
+
+	return resp, nil
+}
+
+func (c *Client) apiHeader() http.Header {
+	return http.Header{
+		"x-user-agent":  {androidUserAgent},
+		"Authorization": {fmt.Sprintf("Bearer %s", c.auth.AccessToken)},
+		"Content-Type":  {contentTypeJson},
+	}
+}
+
+func (c *Client) saveAuth() error {
 	if c.authStore == nil {
-		return
+		return nil
 	}
 
-	e := json.NewEncoder(c.authStore)
-	err := e.Encode(c.auth)
+	err := c.authStore.Save(c.auth)
 	if err != nil {
-		return
+		c.authUnsaved = true
+		c.log(context.Background(), LogLevelError, "saving auth tokens failed", "error", err)
+
+		return fmt.Errorf("can't save auth tokens: %w", err)
 	}
+	c.authUnsaved = false
+
+	return nil
 }
 
 func (c *Client) loadAuth() {
@@ -354,11 +451,13 @@ func (c *Client) loadAuth() {
 		return
 	}
 
-	d := json.NewDecoder(c.authStore)
-	err := d.Decode(&c.auth)
+	token, err := c.authStore.Load()
 	if err != nil {
+		c.log(context.Background(), LogLevelWarn, "loading auth tokens failed", "error", err)
+
 		return
 	}
+	c.auth = token
 }
 
 func (c *Client) refreshAuth(ctx context.Context) error {
@@ -368,220 +467,58 @@ func (c *Client) refreshAuth(ctx context.Context) error {
 	if c.auth == nil {
 		c.loadAuth()
 		if c.auth == nil {
-			c.auth = new(auth)
+			c.auth = new(Token)
 		}
 	}
 
-	if c.auth.Token == "" {
-		err := c.getToken(ctx)
-		if err != nil {
-			return fmt.Errorf("failed to get auth token: %w", err)
-		}
-	} else if c.auth.Token != "" && time.Now().Unix() > c.auth.Expires {
-		err := c.getRefreshToken(ctx)
+	switch {
+	case c.auth.AccessToken == "":
+		err := c.login(ctx)
 		if err != nil {
-			return fmt.Errorf("failed to get refresh token: %w", err)
+			return err
 		}
-	}
-
-	c.saveAuth()
-
-	return nil
-}
-
-func (c *Client) getToken(ctx context.Context) error {
-	// stage1
-	state := randomString(22)
-	codeChallenge := randomString(86)
-	form := url.Values{
-		"client_id":             {clientId},
-		"response_type":         {"code"},
-		"scope":                 {"openid profile email offline_access smacc vehicle_data perseus dlm svds cesim vsapi remote_services fupo authenticate_user"},
-		"redirect_uri":          {"com.bmw.connected://oauth"},
-		"state":                 {state},
-		"nonce":                 {"login_nonce"},
-		"code_challenge":        {codeChallenge},
-		"code_challenge_method": {"plain"},
-		"username":              {c.username},
-		"password":              {c.password},
-		"grant_type":            {"authorization_code"},
-	}
-	body := strings.NewReader(form.Encode())
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, authUrl, body)
-	if err != nil {
-		return fmt.Errorf("getToken stage1 error: can't create request: %w", err)
-	}
-
-	req.Header = http.Header{
-		"Content-Type": {contentTypeUrlEncoded},
-		"User-Agent":   {iosUserAgent},
-	}
-
-	resp, err := c.httpClient.Do(req)
-	if err != nil || resp.StatusCode >= http.StatusBadRequest {
-		return fmt.Errorf("getToken stage1 error: can't send request: %w, %v", err, resp)
-	}
-
-	defer func(body io.ReadCloser) {
-		_ = body.Close()
-	}(resp.Body)
-
-	var stage1Response struct {
-		RedirectTo string `json:"redirect_to,omitempty"`
-	}
-	d := json.NewDecoder(resp.Body)
-	err = d.Decode(&stage1Response)
-	if err != nil {
-		return fmt.Errorf("getToken stage1 error: can't decode response: %w", err)
-	}
-
-	re := regexp.MustCompile(`(?im).*authorization=(.*)`)
-	authString := ""
-	if len(re.FindStringSubmatch(stage1Response.RedirectTo)) > 1 {
-		authString = re.FindStringSubmatch(stage1Response.RedirectTo)[1]
-	}
-	if authString == "" {
-		return fmt.Errorf("getToken stage1 error: can't find redirect link")
-	}
-
-	// stage 2
-	form = url.Values{
-		"client_id":             {clientId},
-		"response_type":         {"code"},
-		"scope":                 {"openid profile email offline_access smacc vehicle_data perseus dlm svds cesim vsapi remote_services fupo authenticate_user"},
-		"redirect_uri":          {"com.bmw.connected://oauth"},
-		"state":                 {state},
-		"nonce":                 {"login_nonce"},
-		"code_challenge":        {codeChallenge},
-		"code_challenge_method": {"plain"},
-		"authorization":         {authString},
-	}
-	req, err = http.NewRequestWithContext(ctx, http.MethodPost, authUrl, strings.NewReader(form.Encode()))
-	if err != nil {
-		return fmt.Errorf("getToken stage2 error: can't create request: %w", err)
-	}
-	req.Header = http.Header{
-		"Content-Type": {contentTypeUrlEncoded},
-		"User-Agent":   {iosUserAgent},
-		"Cookie":       {fmt.Sprintf("GCDMSSO=%s", authString)},
-	}
-
-	resp, err = c.httpClient.Do(req)
-	if err != nil || resp.StatusCode >= http.StatusBadRequest {
-		return fmt.Errorf("getToken stage2 error: can't send request: %w, %v", err, resp)
-	}
-
-	defer func(body io.ReadCloser) {
-		_ = body.Close()
-	}(resp.Body)
-
-	var code string
-	re = regexp.MustCompile(`(?im).*code=(.*?)&`)
-	for k, vs := range resp.Header {
-		if strings.ToLower(k) == "location" {
-			for _, v := range vs {
-				if re.MatchString(v) && len(re.FindStringSubmatch(v)) > 1 {
-					code = re.FindStringSubmatch(v)[1]
-
-					break
-				}
+	case c.auth.Expired():
+		token, err := c.authenticator.Refresh(ctx, c.auth)
+		if isInvalidGrant(err) {
+			// the refresh token was revoked or has expired, only a new login can restore the session
+			c.log(ctx, LogLevelWarn, "refresh token rejected, logging in again", "error", err)
+			err = c.login(ctx)
+			if err != nil {
+				return err
 			}
-		}
 
-		if code != "" {
 			break
 		}
-	}
-	if code == "" {
-		return fmt.Errorf("getToken stage2 error: can't find code")
+		if err != nil {
+			// the current tokens are kept, so the refresh is retried on the next request
+			return fmt.Errorf("failed to get refresh token: %w", err)
+		}
+		c.auth = token
+	case !c.authUnsaved:
+		return nil
 	}
 
-	// stage 3
-	form = url.Values{
-		"code":          {code},
-		"code_verifier": {codeChallenge},
-		"redirect_uri":  {"com.bmw.connected://oauth"},
-		"grant_type":    {"authorization_code"},
-	}
-	req, err = http.NewRequestWithContext(ctx, http.MethodPost, authTokenUrl, strings.NewReader(form.Encode()))
-	if err != nil {
-		return fmt.Errorf("getToken stage3 error: can't create request: %w", err)
-	}
-	req.Header = http.Header{
-		"Content-Type":  {contentTypeUrlEncoded},
-		"User-Agent":    {iosUserAgent},
-		"Cookie":        {fmt.Sprintf("GCDMSSO=%s", authString)},
-		"Authorization": {getBasicAuthHeader()},
+	if c.auth.ExpiresAt == 0 && c.auth.Expires > 0 {
+		// authenticators other than GcdmAuthenticator may only report the lifetime
+		c.auth.ExpiresAt = time.Now().Unix() + c.auth.Expires
 	}
 
-	resp, err = c.httpClient.Do(req)
-	if err != nil || resp.StatusCode >= http.StatusBadRequest {
-		return fmt.Errorf("getToken stage3 error: can't send request: %w, %v", err, resp)
-	}
-
-	defer func(body io.ReadCloser) {
-		_ = body.Close()
-	}(resp.Body)
-
-	d = json.NewDecoder(resp.Body)
-	err = d.Decode(c.auth)
-	if err != nil {
-		return fmt.Errorf("getToken stage3 error: can't decode response: %w", err)
-	}
+	// the tokens in memory stay valid when the store fails, saving is retried on the next request
+	_ = c.saveAuth()
 
 	return nil
 }
 
-func (c *Client) getRefreshToken(ctx context.Context) error {
-	form := url.Values{
-		"redirect_uri":  {"com.bmw.connected://oauth"},
-		"refresh_token": {c.auth.RefreshToken},
-		"grant_type":    {"refresh_token"},
-	}
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, authUrl, strings.NewReader(form.Encode()))
-	if err != nil {
-		return fmt.Errorf("getRefreshToken error: can't create request: %w", err)
-	}
-
-	req.Header = http.Header{
-		"Content-Type":  {contentTypeUrlEncoded},
-		"Authorization": {getBasicAuthHeader()},
-	}
-
-	resp, err := c.httpClient.Do(req)
+func (c *Client) login(ctx context.Context) error {
+	token, err := c.authenticator.Login(ctx, Credentials{
+		Username:     c.username,
+		Password:     c.password,
+		CaptchaToken: c.takeCaptchaToken(),
+	})
 	if err != nil {
-		return fmt.Errorf("getRefreshToken error: can't send request: %w", err)
-	}
-
-	defer func(body io.ReadCloser) {
-		_ = body.Close()
-	}(resp.Body)
-
-	d := json.NewDecoder(resp.Body)
-	err = d.Decode(c.auth)
-	if err != nil {
-		return fmt.Errorf("getRefreshToken error: can't decode response: %w", err)
+		return fmt.Errorf("failed to get auth token: %w", err)
 	}
+	c.auth = token
 
 	return nil
 }
-
-func getBasicAuthHeader() string {
-	return fmt.Sprintf(
-		"Basic %s",
-		base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%s:%s", clientId, clientPassword))),
-	)
-}
-
-func randomString(length int) string {
-	rand.Seed(time.Now().UnixNano())
-
-	characters := "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ-._~"
-	randomString := ""
-
-	for i := 0; i < length; i++ {
-		randomString += string(characters[rand.Intn(len(characters)-1)])
-	}
-
-	return randomString
-}
@@ -0,0 +1,193 @@
+package fuel
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	connecteddrive "github.com/sdrobov/connected-drive"
+	"github.com/sdrobov/connected-drive/history"
+)
+
+const (
+	defaultMinRefuelLiters     = 5
+	defaultMinDropLiters       = 3
+	defaultMaxParkedDistanceKm = 0.5
+)
+
+type Options struct {
+	// TankCapacityLiters converts levels reported in percent. Percent readings are skipped without it.
+	TankCapacityLiters  float64
+	MinRefuelLiters     float64
+	MinDropLiters       float64
+	MaxParkedDistanceKm float64
+}
+
+func (o Options) withDefaults() Options {
+	if o.MinRefuelLiters <= 0 {
+		o.MinRefuelLiters = defaultMinRefuelLiters
+	}
+	if o.MinDropLiters <= 0 {
+		o.MinDropLiters = defaultMinDropLiters
+	}
+	if o.MaxParkedDistanceKm <= 0 {
+		o.MaxParkedDistanceKm = defaultMaxParkedDistanceKm
+	}
+
+	return o
+}
+
+type Refuel struct {
+	At           time.Time `json:"at"`
+	BeforeLiters float64   `json:"beforeLiters"`
+	AfterLiters  float64   `json:"afterLiters"`
+	AddedLiters  float64   `json:"addedLiters"`
+	MileageKm    float64   `json:"mileageKm"`
+	Latitude     float64   `json:"latitude"`
+	Longitude    float64   `json:"longitude"`
+}
+
+// Interval is the consumption between two refuels.
+type Interval struct {
+	From           time.Time `json:"from"`
+	To             time.Time `json:"to"`
+	DistanceKm     float64   `json:"distanceKm"`
+	Liters         float64   `json:"liters"`
+	LitersPer100Km float64   `json:"litersPer100Km"`
+	MpgUs          float64   `json:"mpgUs"`
+	MpgImperial    float64   `json:"mpgImperial"`
+}
+
+type AnomalyType string
+
+const AnomalyDropWhileParked AnomalyType = "FUEL_DROP_WHILE_PARKED"
+
+type Anomaly struct {
+	Type       AnomalyType `json:"type"`
+	From       time.Time   `json:"from"`
+	To         time.Time   `json:"to"`
+	LostLiters float64     `json:"lostLiters"`
+	MileageKm  float64     `json:"mileageKm"`
+	Latitude   float64     `json:"latitude"`
+	Longitude  float64     `json:"longitude"`
+}
+
+type Analysis struct {
+	Refuels   []Refuel   `json:"refuels"`
+	Intervals []Interval `json:"intervals"`
+	Anomalies []Anomaly  `json:"anomalies"`
+}
+
+type reading struct {
+	history.FuelReading
+	liters float64
+	km     float64
+}
+
+// Analyze detects refuels and fuel lost while parked in successive readings of one vehicle and computes
+// the consumption between refuels.
+func Analyze(readings []history.FuelReading, opts Options) *Analysis {
+	opts = opts.withDefaults()
+
+	var rs []reading
+	for _, r := range readings {
+		liters, ok := toLiters(r.Level, opts.TankCapacityLiters)
+		if !ok || r.Mileage.Units == "" {
+			continue
+		}
+
+		rs = append(rs, reading{FuelReading: r, liters: liters, km: r.Mileage.Km()})
+	}
+	sort.SliceStable(rs, func(i, j int) bool {
+		return rs[i].At.Before(rs[j].At)
+	})
+
+	analysis := &Analysis{}
+	for i := 1; i < len(rs); i++ {
+		prev, cur := rs[i-1], rs[i]
+		delta := cur.liters - prev.liters
+
+		if delta >= opts.MinRefuelLiters {
+			analysis.Refuels = append(analysis.Refuels, Refuel{
+				At:           cur.At,
+				BeforeLiters: round(prev.liters),
+				AfterLiters:  round(cur.liters),
+				AddedLiters:  round(delta),
+				MileageKm:    round(cur.km),
+				Latitude:     cur.Location.Latitude,
+				Longitude:    cur.Location.Longitude,
+			})
+
+			continue
+		}
+
+		if -delta >= opts.MinDropLiters && cur.km-prev.km <= opts.MaxParkedDistanceKm {
+			analysis.Anomalies = append(analysis.Anomalies, Anomaly{
+				Type:       AnomalyDropWhileParked,
+				From:       prev.At,
+				To:         cur.At,
+				LostLiters: round(-delta),
+				MileageKm:  round(cur.km),
+				Latitude:   cur.Location.Latitude,
+				Longitude:  cur.Location.Longitude,
+			})
+		}
+	}
+
+	for i := 1; i < len(analysis.Refuels); i++ {
+		from, to := analysis.Refuels[i-1], analysis.Refuels[i]
+		distance := to.MileageKm - from.MileageKm
+		liters := from.AfterLiters - to.BeforeLiters
+		for _, a := range analysis.Anomalies {
+			// anomalies starting at the refuel reading itself count too: fuel drained right after filling up
+			if !a.From.Before(from.At) && !a.To.After(to.At) {
+				liters -= a.LostLiters
+			}
+		}
+		if distance <= 0 || liters <= 0 {
+			continue
+		}
+
+		miles := connecteddrive.Distance{Value: distance, Units: string(connecteddrive.UnitKilometers)}.Miles()
+		volume := connecteddrive.Volume{Value: liters, Units: string(connecteddrive.UnitLiters)}
+		analysis.Intervals = append(analysis.Intervals, Interval{
+			From:           from.At,
+			To:             to.At,
+			DistanceKm:     round(distance),
+			Liters:         round(liters),
+			LitersPer100Km: round(liters / distance * 100),
+			MpgUs:          round(miles / volume.Gallons()),
+			MpgImperial:    round(miles / volume.ImperialGallons()),
+		})
+	}
+
+	return analysis
+}
+
+func AnalyzeStore(store *history.Store, vin string, from time.Time, to time.Time, opts Options) (*Analysis, error) {
+	readings, err := store.FuelOverTime(vin, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	return Analyze(readings, opts), nil
+}
+
+func toLiters(level connecteddrive.Volume, tankCapacityLiters float64) (float64, bool) {
+	if level.Units == "" {
+		return 0, false
+	}
+	if level.IsPercent() {
+		if tankCapacityLiters <= 0 {
+			return 0, false
+		}
+
+		return level.Value / 100 * tankCapacityLiters, true
+	}
+
+	return level.Liters(), true
+}
+
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,81 @@
+package fuel
+
+import (
+	"testing"
+	"time"
+
+	connecteddrive "github.com/sdrobov/connected-drive"
+	"github.com/sdrobov/connected-drive/history"
+)
+
+var start = time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC)
+
+func testReading(hours int, level float64, units string, km float64) history.FuelReading {
+	return history.FuelReading{
+		At:      start.Add(time.Duration(hours) * time.Hour),
+		Level:   connecteddrive.Volume{Value: level, Units: units},
+		Mileage: connecteddrive.Distance{Value: km, Units: "KILOMETERS"},
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	readings := []history.FuelReading{
+		testReading(5, 60, "LITERS", 1250),
+		testReading(0, 10, "LITERS", 1000),
+		testReading(1, 50, "LITERS", 1000),
+		// drained while parked right after filling up
+		testReading(2, 45, "LITERS", 1000),
+		testReading(3, 30, "LITERS", 1200),
+		testReading(4, 28, "LITERS", 1250),
+		// skipped: percent without a tank capacity, and no mileage
+		testReading(4, 10, "PERCENT", 1250),
+		{At: start.Add(4 * time.Hour), Level: connecteddrive.Volume{Value: 1, Units: "LITERS"}},
+	}
+
+	a := Analyze(readings, Options{})
+
+	if len(a.Refuels) != 2 {
+		t.Fatalf("got refuels %+v, want 2", a.Refuels)
+	}
+	if r := a.Refuels[0]; r.AddedLiters != 40 || r.BeforeLiters != 10 || !r.At.Equal(start.Add(time.Hour)) {
+		t.Errorf("first refuel = %+v", r)
+	}
+	if r := a.Refuels[1]; r.AddedLiters != 32 || r.MileageKm != 1250 {
+		t.Errorf("second refuel = %+v", r)
+	}
+
+	if len(a.Anomalies) != 1 {
+		t.Fatalf("got anomalies %+v, want 1", a.Anomalies)
+	}
+	if an := a.Anomalies[0]; an.Type != AnomalyDropWhileParked || an.LostLiters != 5 || !an.From.Equal(a.Refuels[0].At) {
+		t.Errorf("anomaly = %+v", an)
+	}
+
+	if len(a.Intervals) != 1 {
+		t.Fatalf("got intervals %+v, want 1", a.Intervals)
+	}
+	// 50 l after the first refuel, 28 l before the second, 5 l of them drained
+	if i := a.Intervals[0]; i.DistanceKm != 250 || i.Liters != 17 || i.LitersPer100Km != 6.8 {
+		t.Errorf("interval = %+v", i)
+	}
+}
+
+func TestAnalyzeUnits(t *testing.T) {
+	readings := []history.FuelReading{
+		testReading(0, 20, "PERCENT", 1000),
+		testReading(1, 80, "PERCENT", 1000),
+		testReading(2, 10, "GALLONS", 1400),
+		testReading(3, 20, "GALLONS", 1400),
+	}
+
+	a := Analyze(readings, Options{TankCapacityLiters: 50})
+	if len(a.Refuels) != 2 || a.Refuels[0].AddedLiters != 30 || a.Refuels[1].AddedLiters != 37.85 {
+		t.Fatalf("got refuels %+v", a.Refuels)
+	}
+
+	// 40 l after the first refuel, 10 US gallons before the second
+	i := a.Intervals[0]
+	if i.Liters != 2.15 || i.DistanceKm != 400 || i.LitersPer100Km != 0.54 {
+		t.Errorf("interval = %+v", i)
+	}
+}
@@ -0,0 +1,469 @@
+package connected_drive
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	gcdmRedirectUri = "com.bmw.connected://oauth"
+	gcdmScope       = "openid profile email offline_access smacc vehicle_data perseus dlm svds cesim vsapi remote_services fupo authenticate_user"
+	gcdmCookie      = "GCDMSSO"
+	gcdmRevokeUrl   = "https://customer.bmwgroup.com/gcdm/oauth/revoke"
+)
+
+// GcdmAuthenticator logs in against the BMW customer data management (GCDM) OAuth server in three stages:
+// credentials are exchanged for an authorization, the authorization for a code and the code for tokens.
+// The defaults target the rest-of-world region; change the URLs and client for other regions.
+type GcdmAuthenticator struct {
+	// HttpClient sends the requests to the OAuth server, http.DefaultClient is used when it is nil.
+	HttpClient     *http.Client
+	AuthUrl        string
+	TokenUrl       string
+	RevokeUrl      string
+	ClientId       string
+	ClientPassword string
+	RedirectUri    string
+	Scope          string
+	UserAgent      string
+	CaptchaSolver  CaptchaSolver
+	// Logger receives the stages of the login and refreshes, with secrets redacted. It is wrapped for redaction
+	// on first use, so set it before the authenticator is used.
+	Logger Logger
+	// Tracer and Meter instrument the login, refreshes and every request to the OAuth server.
+	Tracer Tracer
+	Meter  Meter
+
+	logger     Logger
+	loggerOnce sync.Once
+}
+
+func NewGcdmAuthenticator(httpClient *http.Client) *GcdmAuthenticator {
+	return &GcdmAuthenticator{
+		HttpClient:     httpClient,
+		AuthUrl:        authUrl,
+		TokenUrl:       authTokenUrl,
+		RevokeUrl:      gcdmRevokeUrl,
+		ClientId:       clientId,
+		ClientPassword: clientPassword,
+		RedirectUri:    gcdmRedirectUri,
+		Scope:          gcdmScope,
+		UserAgent:      iosUserAgent,
+	}
+}
+
+func (a *GcdmAuthenticator) Login(ctx context.Context, credentials Credentials) (token *Token, err error) {
+	ctx, op := newInstrumentation(a.Tracer, a.Meter).start(
+		ctx,
+		"connecteddrive.Login",
+		MetricOperationDuration,
+		Attr(AttrOperation, "Login"),
+	)
+	defer func() { op.end(err) }()
+
+	start := time.Now()
+	a.log(ctx, LogLevelInfo, "logging in", "captchaToken", credentials.CaptchaToken != "")
+	defer func() {
+		if err != nil {
+			a.log(ctx, LogLevelWarn, "login failed", "error", err, "duration", time.Since(start))
+
+			return
+		}
+		a.log(ctx, LogLevelInfo, "logged in", "expiresIn", token.Expires, "duration", time.Since(start))
+	}()
+
+	p, err := newPkce()
+	if err != nil {
+		return nil, fmt.Errorf("getToken stage1 error: can't generate PKCE parameters: %w", err)
+	}
+
+	authorization, err := a.authenticate(ctx, p, credentials)
+	if err != nil {
+		return nil, err
+	}
+
+	code, err := a.authorize(ctx, p, authorization)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err = a.exchangeCode(ctx, p, authorization, code)
+	if err != nil {
+		return nil, err
+	}
+
+	if token.IdToken != "" {
+		claims, err := ParseIdToken(token.IdToken)
+		if err != nil {
+			return nil, fmt.Errorf("getToken stage3 error: %w", err)
+		}
+		// a nonce was sent with the login, so a token without it may be replayed from another login
+		err = p.validateNonce(claims.Nonce)
+		if err != nil {
+			return nil, fmt.Errorf("getToken stage3 error: %w", err)
+		}
+	}
+
+	return token, nil
+}
+
+func (a *GcdmAuthenticator) authParams(p *pkce) url.Values {
+	return url.Values{
+		"client_id":             {a.ClientId},
+		"response_type":         {"code"},
+		"scope":                 {a.Scope},
+		"redirect_uri":          {a.RedirectUri},
+		"state":                 {p.state},
+		"nonce":                 {p.nonce},
+		"code_challenge":        {p.challenge},
+		"code_challenge_method": {pkceMethod},
+	}
+}
+
+// authenticate sends the credentials (stage 1) and returns the authorization from the redirect link.
+// A captcha token is attached when given; if the server asks for one, the captcha solver is consulted once.
+func (a *GcdmAuthenticator) authenticate(ctx context.Context, p *pkce, credentials Credentials) (string, error) {
+	form := a.authParams(p)
+	form.Set("username", credentials.Username)
+	form.Set("password", credentials.Password)
+	form.Set("grant_type", "authorization_code")
+
+	captchaToken := credentials.CaptchaToken
+	for attempt := 0; ; attempt++ {
+		header := http.Header{
+			"Content-Type": {contentTypeUrlEncoded},
+			"User-Agent":   {a.UserAgent},
+		}
+		if captchaToken != "" {
+			header.Set(captchaTokenHeader, captchaToken)
+		}
+
+		resp, body, err := a.post(ctx, "getToken stage1", a.AuthUrl, form, header, Attr(AttrRetryCount, attempt))
+		if err != nil {
+			return "", fmt.Errorf("getToken stage1 error: %w", err)
+		}
+
+		if resp.StatusCode >= http.StatusBadRequest {
+			if !isCaptchaResponse(resp.StatusCode, body) {
+				return "", newAuthError("getToken stage1", resp, body)
+			}
+
+			challenge := newCaptchaChallenge(resp.StatusCode, body)
+			a.log(ctx, LogLevelWarn, "captcha required", "attempt", attempt, "message", challenge.Message)
+			if a.CaptchaSolver == nil || attempt > 0 {
+				return "", fmt.Errorf("getToken stage1 error: %w", &CaptchaError{Challenge: challenge})
+			}
+
+			captchaToken, err = a.CaptchaSolver.SolveCaptcha(ctx, challenge)
+			if err != nil {
+				return "", fmt.Errorf("getToken stage1 error: can't solve captcha: %w", err)
+			}
+			a.log(ctx, LogLevelInfo, "captcha solved, retrying login")
+
+			continue
+		}
+
+		var stage1Response struct {
+			RedirectTo string `json:"redirect_to,omitempty"`
+		}
+		err = json.Unmarshal(body, &stage1Response)
+		if err != nil {
+			return "", fmt.Errorf("getToken stage1 error: can't decode response: %w", err)
+		}
+
+		query, err := redirectQuery(stage1Response.RedirectTo)
+		if err != nil {
+			return "", fmt.Errorf("getToken stage1 error: can't parse redirect link: %w", err)
+		}
+		if query.Get("error") != "" {
+			return "", &AuthError{
+				Stage:       "getToken stage1",
+				StatusCode:  resp.StatusCode,
+				Code:        query.Get("error"),
+				Description: query.Get("error_description"),
+			}
+		}
+
+		authorization := query.Get("authorization")
+		if authorization == "" {
+			return "", fmt.Errorf("getToken stage1 error: can't find authorization in redirect link")
+		}
+
+		return authorization, nil
+	}
+}
+
+// authorize exchanges the authorization for a code (stage 2). The code comes in the query of the redirect
+// to the app, which must carry the state sent with the login.
+func (a *GcdmAuthenticator) authorize(ctx context.Context, p *pkce, authorization string) (string, error) {
+	form := a.authParams(p)
+	form.Set("authorization", authorization)
+
+	resp, body, err := a.post(ctx, "getToken stage2", a.AuthUrl, form, http.Header{
+		"Content-Type": {contentTypeUrlEncoded},
+		"User-Agent":   {a.UserAgent},
+		"Cookie":       {fmt.Sprintf("%s=%s", gcdmCookie, authorization)},
+	})
+	if err != nil {
+		return "", fmt.Errorf("getToken stage2 error: %w", err)
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return "", newAuthError("getToken stage2", resp, body)
+	}
+
+	location := resp.Header.Get("Location")
+	if location == "" {
+		return "", fmt.Errorf("getToken stage2 error: no redirect in response, status %d", resp.StatusCode)
+	}
+
+	u, err := url.Parse(location)
+	if err != nil {
+		return "", fmt.Errorf("getToken stage2 error: can't parse redirect: %w", err)
+	}
+
+	query := u.Query()
+	if query.Get("error") != "" {
+		return "", &AuthError{
+			Stage:       "getToken stage2",
+			StatusCode:  resp.StatusCode,
+			Code:        query.Get("error"),
+			Description: query.Get("error_description"),
+		}
+	}
+
+	err = p.validateState(query)
+	if err != nil {
+		return "", fmt.Errorf("getToken stage2 error: %w", err)
+	}
+
+	code := query.Get("code")
+	if code == "" {
+		return "", fmt.Errorf("getToken stage2 error: can't find code")
+	}
+
+	return code, nil
+}
+
+// exchangeCode redeems the code for tokens (stage 3).
+func (a *GcdmAuthenticator) exchangeCode(ctx context.Context, p *pkce, authorization string, code string) (*Token, error) {
+	form := url.Values{
+		"code":          {code},
+		"code_verifier": {p.verifier},
+		"redirect_uri":  {a.RedirectUri},
+		"grant_type":    {"authorization_code"},
+	}
+
+	resp, body, err := a.post(ctx, "getToken stage3", a.TokenUrl, form, http.Header{
+		"Content-Type":  {contentTypeUrlEncoded},
+		"User-Agent":    {a.UserAgent},
+		"Cookie":        {fmt.Sprintf("%s=%s", gcdmCookie, authorization)},
+		"Authorization": {a.basicAuthHeader()},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("getToken stage3 error: %w", err)
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return nil, newAuthError("getToken stage3", resp, body)
+	}
+
+	token, err := parseTokenResponse(body, nil)
+	if err != nil {
+		return nil, fmt.Errorf("getToken stage3 error: %w", err)
+	}
+
+	return token, nil
+}
+
+// Refresh exchanges the refresh token for a new access token. token is never modified; when the server
+// doesn't rotate the refresh token, the old one is carried over to the returned token.
+func (a *GcdmAuthenticator) Refresh(ctx context.Context, token *Token) (refreshed *Token, err error) {
+	ctx, op := newInstrumentation(a.Tracer, a.Meter).start(
+		ctx,
+		"connecteddrive.Refresh",
+		MetricOperationDuration,
+		Attr(AttrOperation, "Refresh"),
+	)
+	defer func() { op.end(err) }()
+
+	a.log(ctx, LogLevelInfo, "refreshing access token")
+	defer func() {
+		if err != nil {
+			a.log(ctx, LogLevelWarn, "refreshing access token failed", "error", err)
+
+			return
+		}
+		a.log(
+			ctx,
+			LogLevelInfo,
+			"access token refreshed",
+			"rotated", refreshed.RefreshToken != token.RefreshToken,
+			"expiresIn", refreshed.Expires,
+		)
+	}()
+
+	if token.RefreshToken == "" {
+		return nil, &AuthError{Stage: "getRefreshToken", Code: "invalid_grant", Description: "no refresh token"}
+	}
+
+	form := url.Values{
+		"redirect_uri":  {a.RedirectUri},
+		"refresh_token": {token.RefreshToken},
+		"grant_type":    {"refresh_token"},
+	}
+
+	resp, body, err := a.post(ctx, "getRefreshToken", a.TokenUrl, form, http.Header{
+		"Content-Type":  {contentTypeUrlEncoded},
+		"User-Agent":    {a.UserAgent},
+		"Authorization": {a.basicAuthHeader()},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("getRefreshToken error: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAuthError("getRefreshToken", resp, body)
+	}
+
+	refreshed, err = parseTokenResponse(body, token)
+	if err != nil {
+		return nil, fmt.Errorf("getRefreshToken error: %w", err)
+	}
+
+	return refreshed, nil
+}
+
+// Revoke revokes the refresh token, or the access token if there is none. Servers answering that the endpoint
+// does not exist yield ErrRevocationUnsupported.
+func (a *GcdmAuthenticator) Revoke(ctx context.Context, token *Token) error {
+	if a.RevokeUrl == "" {
+		return ErrRevocationUnsupported
+	}
+
+	form := url.Values{
+		"token":           {token.RefreshToken},
+		"token_type_hint": {"refresh_token"},
+	}
+	if token.RefreshToken == "" {
+		form = url.Values{
+			"token":           {token.AccessToken},
+			"token_type_hint": {"access_token"},
+		}
+	}
+
+	resp, body, err := a.post(ctx, "revoke", a.RevokeUrl, form, http.Header{
+		"Content-Type":  {contentTypeUrlEncoded},
+		"User-Agent":    {a.UserAgent},
+		"Authorization": {a.basicAuthHeader()},
+	})
+	if err != nil {
+		return fmt.Errorf("revoke error: %w", err)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return ErrRevocationUnsupported
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		authErr := newAuthError("revoke", resp, body)
+		if authErr.Code == "unsupported_token_type" {
+			return ErrRevocationUnsupported
+		}
+
+		return authErr
+	}
+
+	return nil
+}
+
+func (a *GcdmAuthenticator) post(
+	ctx context.Context,
+	stage string,
+	endpoint string,
+	form url.Values,
+	header http.Header,
+	attrs ...Attribute,
+) (resp *http.Response, body []byte, err error) {
+	attrs = append([]Attribute{Attr(AttrAuthStage, stage), Attr(AttrHttpMethod, http.MethodPost)}, attrs...)
+	ctx, op := newInstrumentation(a.Tracer, a.Meter).start(ctx, "connecteddrive.auth", MetricAuthDuration, attrs...)
+	defer func() {
+		if err == nil && resp.StatusCode >= http.StatusBadRequest {
+			op.end(fmt.Errorf("status %d", resp.StatusCode))
+
+			return
+		}
+		op.end(err)
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, nil, fmt.Errorf("can't create request: %w", err)
+	}
+	req.Header = header
+	op.setAttributes(Attr(AttrEndpoint, logUrl(req.URL)))
+
+	// redirects carry the results of the stages and must not be followed
+	client := *http.DefaultClient
+	if a.HttpClient != nil {
+		client = *a.HttpClient
+	}
+	client.CheckRedirect = func(_ *http.Request, _ []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	start := time.Now()
+	a.log(ctx, LogLevelDebug, "auth request", "stage", stage, "url", logUrl(req.URL))
+
+	resp, err = client.Do(req)
+	if err != nil {
+		a.log(ctx, LogLevelWarn, "auth request failed", "stage", stage, "error", err, "duration", time.Since(start))
+
+		return nil, nil, fmt.Errorf("can't send request: %w", err)
+	}
+	a.log(ctx, LogLevelDebug, "auth response", "stage", stage, "status", resp.StatusCode, "duration", time.Since(start))
+	op.setAttributes(Attr(AttrStatusCode, resp.StatusCode))
+
+	defer func(body io.ReadCloser) {
+		_ = body.Close()
+	}(resp.Body)
+
+	body, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("can't read response: %w", err)
+	}
+
+	return resp, body, nil
+}
+
+func (a *GcdmAuthenticator) log(ctx context.Context, level LogLevel, msg string, keyvals ...interface{}) {
+	a.loggerOnce.Do(func() {
+		a.logger = newRedactingLogger(a.Logger, false)
+	})
+	if a.logger == nil {
+		return
+	}
+
+	a.logger.Log(ctx, level, msg, keyvals...)
+}
+
+func (a *GcdmAuthenticator) basicAuthHeader() string {
+	return fmt.Sprintf(
+		"Basic %s",
+		base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%s:%s", a.ClientId, a.ClientPassword))),
+	)
+}
+
+// redirectQuery returns the query parameters of a redirect link, which may be a full URL or only its query.
+func redirectQuery(redirect string) (url.Values, error) {
+	if i := strings.Index(redirect, "?"); i >= 0 {
+		redirect = redirect[i+1:]
+	}
+
+	return url.ParseQuery(redirect)
+}
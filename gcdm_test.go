@@ -0,0 +1,70 @@
+package connected_drive
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+)
+
+func testIdToken(t *testing.T, claims map[string]interface{}) string {
+	t.Helper()
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","kid":"test"}`)) + "." +
+		base64.RawURLEncoding.EncodeToString(payload) + ".c2lnbmF0dXJl"
+}
+
+func TestLoginRequiresIdTokenNonce(t *testing.T) {
+	tests := []struct {
+		name    string
+		idToken func(nonce string) string
+		wantErr bool
+	}{
+		{"no id token", nil, false},
+		{"matching nonce", func(nonce string) string {
+			return testIdToken(t, map[string]interface{}{"sub": "user", "nonce": nonce})
+		}, false},
+		{"missing nonce", func(string) string {
+			return testIdToken(t, map[string]interface{}{"sub": "user"})
+		}, true},
+		{"other nonce", func(string) string {
+			return testIdToken(t, map[string]interface{}{"sub": "user", "nonce": "replayed"})
+		}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, _ := newTestGcdmServer(t, testGcdm{idToken: tt.idToken})
+			gcdm := NewGcdmAuthenticator(server.Client())
+			gcdm.AuthUrl = server.URL + "/auth"
+			gcdm.TokenUrl = server.URL + "/token"
+
+			token, err := gcdm.Login(context.Background(), Credentials{Username: "user@example.com", Password: "password"})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Login error %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && token.AccessToken != "login-access" {
+				t.Errorf("got access token %q", token.AccessToken)
+			}
+		})
+	}
+}
+
+func TestLoginWithoutHttpClient(t *testing.T) {
+	server, logins := newTestGcdmServer(t, testGcdm{})
+	gcdm := &GcdmAuthenticator{
+		AuthUrl:     server.URL + "/auth",
+		TokenUrl:    server.URL + "/token",
+		RedirectUri: gcdmRedirectUri,
+	}
+
+	_, err := gcdm.Login(context.Background(), Credentials{Username: "user@example.com", Password: "password"})
+	if err != nil || *logins != 1 {
+		t.Errorf("Login: %v, %d logins", err, *logins)
+	}
+}
@@ -0,0 +1,412 @@
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	connecteddrive "github.com/sdrobov/connected-drive"
+)
+
+var ErrClosed = errors.New("history store is closed")
+
+type Retention struct {
+	MaxAge                 time.Duration
+	MaxSnapshotsPerVehicle int
+}
+
+type Snapshot struct {
+	Vin       string                  `json:"vin"`
+	At        time.Time               `json:"at"`
+	FetchedAt time.Time               `json:"fetchedAt"`
+	Hash      string                  `json:"hash"`
+	Vehicle   *connecteddrive.Vehicle `json:"vehicle"`
+}
+
+type record struct {
+	Vin       string          `json:"vin"`
+	At        time.Time       `json:"at"`
+	FetchedAt time.Time       `json:"fetchedAt"`
+	Hash      string          `json:"hash"`
+	Vehicle   json.RawMessage `json:"vehicle"`
+}
+
+type entry struct {
+	at     time.Time
+	hash   string
+	offset int64
+	length int
+}
+
+// Store is an embedded, append-only snapshot store kept in a single file of JSON lines. An in-memory index
+// of offsets per VIN is built on Open; vehicles are read from disk on demand.
+type Store struct {
+	path      string
+	file      *os.File
+	size      int64
+	index     map[string][]entry
+	retention Retention
+	mutex     *sync.RWMutex
+}
+
+func Open(path string, retention Retention) (*Store, error) {
+	err := os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		return nil, fmt.Errorf("history error: can't create directory: %w", err)
+	}
+
+	s := &Store{
+		path:      path,
+		retention: retention,
+		mutex:     &sync.RWMutex{},
+	}
+
+	err = s.open()
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *Store) open() error {
+	f, err := os.OpenFile(s.path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("history error: can't open %s: %w", s.path, err)
+	}
+
+	index := make(map[string][]entry)
+	r := bufio.NewReader(f)
+	var offset int64
+	for {
+		line, readErr := r.ReadBytes('\n')
+		if readErr == io.EOF && len(line) > 0 {
+			// incomplete last record of an interrupted write
+			break
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			_ = f.Close()
+
+			return fmt.Errorf("history error: can't read %s: %w", s.path, readErr)
+		}
+
+		var rec record
+		err = json.Unmarshal(line, &rec)
+		if err != nil {
+			_ = f.Close()
+
+			return fmt.Errorf("history error: corrupt record at offset %d: %w", offset, err)
+		}
+
+		index[rec.Vin] = append(index[rec.Vin], entry{
+			at:     rec.At,
+			hash:   rec.Hash,
+			offset: offset,
+			length: len(line),
+		})
+		offset += int64(len(line))
+	}
+
+	err = f.Truncate(offset)
+	if err != nil {
+		_ = f.Close()
+
+		return fmt.Errorf("history error: can't truncate %s: %w", s.path, err)
+	}
+
+	for _, entries := range index {
+		sort.SliceStable(entries, func(i, j int) bool {
+			return entries[i].at.Before(entries[j].at)
+		})
+	}
+
+	s.file = f
+	s.size = offset
+	s.index = index
+
+	return nil
+}
+
+func (s *Store) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+
+	err := s.file.Close()
+	s.file = nil
+
+	return err
+}
+
+// Save appends a snapshot of every vehicle whose state changed since its last stored snapshot and
+// returns the number of snapshots written.
+func (s *Store) Save(vehicles connecteddrive.Vehicles, fetchedAt time.Time) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.file == nil {
+		return 0, ErrClosed
+	}
+
+	var buf bytes.Buffer
+	var added []struct {
+		vin   string
+		entry entry
+	}
+	offset := s.size
+	for _, v := range vehicles {
+		if v == nil {
+			continue
+		}
+
+		hash, err := snapshotHash(v)
+		if err != nil {
+			return 0, fmt.Errorf("history error: can't hash snapshot of %s: %w", v.Vin, err)
+		}
+		if entries := s.index[v.Vin]; len(entries) > 0 && entries[len(entries)-1].hash == hash {
+			continue
+		}
+
+		vehicle, err := json.Marshal(v)
+		if err != nil {
+			return 0, fmt.Errorf("history error: can't encode snapshot of %s: %w", v.Vin, err)
+		}
+
+		at := v.Properties.LastUpdatedAt
+		if at.IsZero() {
+			at = fetchedAt
+		}
+
+		line, err := json.Marshal(record{Vin: v.Vin, At: at, FetchedAt: fetchedAt, Hash: hash, Vehicle: vehicle})
+		if err != nil {
+			return 0, fmt.Errorf("history error: can't encode snapshot of %s: %w", v.Vin, err)
+		}
+		line = append(line, '\n')
+		buf.Write(line)
+
+		added = append(added, struct {
+			vin   string
+			entry entry
+		}{v.Vin, entry{at: at, hash: hash, offset: offset, length: len(line)}})
+		offset += int64(len(line))
+	}
+
+	if len(added) == 0 {
+		return 0, nil
+	}
+
+	_, err := s.file.WriteAt(buf.Bytes(), s.size)
+	if err == nil {
+		err = s.file.Sync()
+	}
+	if err != nil {
+		_ = s.file.Truncate(s.size)
+
+		return 0, fmt.Errorf("history error: can't write snapshots: %w", err)
+	}
+	s.size = offset
+
+	for _, a := range added {
+		entries := append(s.index[a.vin], a.entry)
+		sort.SliceStable(entries, func(i, j int) bool {
+			return entries[i].at.Before(entries[j].at)
+		})
+		s.index[a.vin] = entries
+	}
+
+	return len(added), nil
+}
+
+func (s *Store) Vins() []string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	vins := make([]string, 0, len(s.index))
+	for vin := range s.index {
+		vins = append(vins, vin)
+	}
+	sort.Strings(vins)
+
+	return vins
+}
+
+// Snapshots returns the snapshots of the vehicle between from and to, oldest first. Zero bounds are open.
+func (s *Store) Snapshots(vin string, from time.Time, to time.Time) ([]Snapshot, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if s.file == nil {
+		return nil, ErrClosed
+	}
+
+	var snapshots []Snapshot
+	for _, e := range s.index[vin] {
+		if (!from.IsZero() && e.at.Before(from)) || (!to.IsZero() && e.at.After(to)) {
+			continue
+		}
+
+		snapshot, err := s.read(e)
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+
+	return snapshots, nil
+}
+
+func (s *Store) Latest(vin string) (*Snapshot, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if s.file == nil {
+		return nil, ErrClosed
+	}
+
+	entries := s.index[vin]
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	snapshot, err := s.read(entries[len(entries)-1])
+	if err != nil {
+		return nil, err
+	}
+
+	return &snapshot, nil
+}
+
+func (s *Store) read(e entry) (Snapshot, error) {
+	line := make([]byte, e.length)
+	_, err := s.file.ReadAt(line, e.offset)
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("history error: can't read snapshot at offset %d: %w", e.offset, err)
+	}
+
+	var rec record
+	err = json.Unmarshal(line, &rec)
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("history error: corrupt record at offset %d: %w", e.offset, err)
+	}
+
+	snapshot := Snapshot{Vin: rec.Vin, At: rec.At, FetchedAt: rec.FetchedAt, Hash: rec.Hash}
+	err = json.Unmarshal(rec.Vehicle, &snapshot.Vehicle)
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("history error: corrupt vehicle at offset %d: %w", e.offset, err)
+	}
+
+	return snapshot, nil
+}
+
+// Compact applies the retention policy and rewrites the store file without the dropped snapshots.
+// The file is replaced atomically.
+func (s *Store) Compact(now time.Time) (removed int, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.file == nil {
+		return 0, ErrClosed
+	}
+
+	var keep []entry
+	for _, entries := range s.index {
+		kept := entries
+		if s.retention.MaxAge > 0 {
+			cutoff := now.Add(-s.retention.MaxAge)
+			i := sort.Search(len(kept), func(i int) bool {
+				return !kept[i].at.Before(cutoff)
+			})
+			kept = kept[i:]
+		}
+		if s.retention.MaxSnapshotsPerVehicle > 0 && len(kept) > s.retention.MaxSnapshotsPerVehicle {
+			kept = kept[len(kept)-s.retention.MaxSnapshotsPerVehicle:]
+		}
+
+		removed += len(entries) - len(kept)
+		keep = append(keep, kept...)
+	}
+
+	if removed == 0 {
+		return 0, nil
+	}
+
+	sort.Slice(keep, func(i, j int) bool {
+		return keep[i].offset < keep[j].offset
+	})
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".compact*")
+	if err != nil {
+		return 0, fmt.Errorf("history error: can't create compaction file: %w", err)
+	}
+
+	w := bufio.NewWriter(tmp)
+	for _, e := range keep {
+		line := make([]byte, e.length)
+		_, err = s.file.ReadAt(line, e.offset)
+		if err == nil {
+			_, err = w.Write(line)
+		}
+		if err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+
+		return 0, fmt.Errorf("history error: can't compact %s: %w", s.path, err)
+	}
+
+	_ = s.file.Close()
+	s.file = nil
+
+	err = s.open()
+	if err != nil {
+		return 0, err
+	}
+
+	return removed, nil
+}
+
+// snapshotHash identifies the vehicle state. The relative timestamp text is left out since it changes
+// with every fetch while the state itself does not.
+func snapshotHash(v *connecteddrive.Vehicle) (string, error) {
+	c := *v
+	c.Status.TimestampMessage = ""
+
+	b, err := json.Marshal(&c)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(b)
+
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,157 @@
+package history
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	connecteddrive "github.com/sdrobov/connected-drive"
+)
+
+var start = time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC)
+
+func testVehicle(vin string, at time.Time, fuel float64) *connecteddrive.Vehicle {
+	v := &connecteddrive.Vehicle{Vin: vin}
+	v.Properties.LastUpdatedAt = at
+	v.Properties.FuelLevel = connecteddrive.Volume{Value: fuel, Units: "LITERS"}
+
+	return v
+}
+
+// refetched returns the vehicle as a later fetch of the same state reports it.
+func refetched(v *connecteddrive.Vehicle) *connecteddrive.Vehicle {
+	c := *v
+	c.Status.TimestampMessage = "Updated a minute ago"
+
+	return &c
+}
+
+func openTestStore(t *testing.T, path string, retention Retention) *Store {
+	t.Helper()
+
+	s, err := Open(path, retention)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { _ = s.Close() })
+
+	return s
+}
+
+func save(t *testing.T, s *Store, want int, vehicles ...*connecteddrive.Vehicle) {
+	t.Helper()
+
+	n, err := s.Save(vehicles, vehicles[0].Properties.LastUpdatedAt)
+	if err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if n != want {
+		t.Errorf("Save wrote %d snapshots, want %d", n, want)
+	}
+}
+
+func TestSaveSkipsUnchangedVehicles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	s := openTestStore(t, path, Retention{})
+
+	a := testVehicle("A", start, 40)
+	save(t, s, 2, a, testVehicle("B", start, 30))
+	save(t, s, 1, refetched(a), testVehicle("B", start.Add(time.Hour), 25))
+	save(t, s, 1, testVehicle("A", start.Add(2*time.Hour), 35))
+
+	snapshots, err := s.Snapshots("A", time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("Snapshots: %v", err)
+	}
+	if len(snapshots) != 2 || snapshots[1].Vehicle.Properties.FuelLevel.Value != 35 {
+		t.Errorf("got snapshots %+v", snapshots)
+	}
+
+	snapshots, err = s.Snapshots("A", start.Add(time.Minute), time.Time{})
+	if err != nil || len(snapshots) != 1 {
+		t.Errorf("Snapshots from a bound: %d, %v", len(snapshots), err)
+	}
+
+	latest, err := s.Latest("B")
+	if err != nil || latest == nil || latest.Vehicle.Properties.FuelLevel.Value != 25 {
+		t.Errorf("Latest: %+v, %v", latest, err)
+	}
+}
+
+func TestOpenRebuildsIndexAndDropsTornRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	s := openTestStore(t, path, Retention{})
+	a := testVehicle("A", start.Add(time.Hour), 35)
+	save(t, s, 2, testVehicle("A", start, 40), testVehicle("B", start, 30))
+	save(t, s, 1, a)
+	_ = s.Close()
+
+	_, err := s.Save(connecteddrive.Vehicles{testVehicle("A", start, 1)}, start)
+	if !errors.Is(err, ErrClosed) {
+		t.Errorf("Save on a closed store: %v", err)
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.WriteString(`{"vin":"A","at":"2024-03-0`)
+	_ = f.Close()
+
+	s = openTestStore(t, path, Retention{})
+	if vins := s.Vins(); len(vins) != 2 {
+		t.Errorf("Vins = %v", vins)
+	}
+	snapshots, err := s.Snapshots("A", time.Time{}, time.Time{})
+	if err != nil || len(snapshots) != 2 {
+		t.Fatalf("Snapshots after reopening: %d, %v", len(snapshots), err)
+	}
+
+	// the unchanged latest state is still recognised and the torn record was cut off
+	save(t, s, 0, refetched(a))
+	save(t, s, 1, testVehicle("A", start.Add(3*time.Hour), 30))
+	snapshots, err = s.Snapshots("A", time.Time{}, time.Time{})
+	if err != nil || len(snapshots) != 3 {
+		t.Errorf("Snapshots after appending: %d, %v", len(snapshots), err)
+	}
+}
+
+func TestCompact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	s := openTestStore(t, path, Retention{MaxAge: 48 * time.Hour, MaxSnapshotsPerVehicle: 2})
+
+	for i := 0; i < 5; i++ {
+		at := start.Add(time.Duration(i) * 24 * time.Hour)
+		save(t, s, 2, testVehicle("A", at, float64(50-i)), testVehicle("B", at, float64(40-i)))
+	}
+	save(t, s, 1, testVehicle("C", start, 10))
+
+	now := start.Add(4 * 24 * time.Hour)
+	removed, err := s.Compact(now)
+	if err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+	// A and B keep their last two snapshots, C is older than MaxAge
+	if removed != 7 {
+		t.Errorf("Compact removed %d snapshots, want 7", removed)
+	}
+
+	removed, err = s.Compact(now)
+	if err != nil || removed != 0 {
+		t.Errorf("second Compact removed %d, %v", removed, err)
+	}
+
+	_ = s.Close()
+	s = openTestStore(t, path, Retention{})
+	for _, vin := range []string{"A", "B"} {
+		snapshots, err := s.Snapshots(vin, time.Time{}, time.Time{})
+		if err != nil || len(snapshots) != 2 || !snapshots[1].At.Equal(now) {
+			t.Errorf("%s after compaction: %+v, %v", vin, snapshots, err)
+		}
+	}
+	if latest, err := s.Latest("C"); err != nil || latest != nil {
+		t.Errorf("C after compaction: %+v, %v", latest, err)
+	}
+}
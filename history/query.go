@@ -0,0 +1,115 @@
+package history
+
+import (
+	"time"
+
+	connecteddrive "github.com/sdrobov/connected-drive"
+)
+
+type FuelReading struct {
+	At       time.Time               `json:"at"`
+	Level    connecteddrive.Volume   `json:"level"`
+	Range    connecteddrive.Distance `json:"range"`
+	Mileage  connecteddrive.Distance `json:"mileage"`
+	InMotion bool                    `json:"inMotion"`
+	Location struct {
+		Latitude  float64 `json:"latitude"`
+		Longitude float64 `json:"longitude"`
+	} `json:"location"`
+}
+
+type LockStateChange struct {
+	At             time.Time                `json:"at"`
+	State          connecteddrive.LockState `json:"state"`
+	AreDoorsLocked bool                     `json:"areDoorsLocked"`
+	IsSecure       bool                     `json:"isSecure"`
+	OpenOpenings   []string                 `json:"openOpenings"`
+}
+
+// MileageOverTime returns the odometer readings of the vehicle, skipping readings that did not change.
+func (s *Store) MileageOverTime(vin string, from time.Time, to time.Time) ([]connecteddrive.MileageReading, error) {
+	snapshots, err := s.Snapshots(vin, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	var readings []connecteddrive.MileageReading
+	for _, snapshot := range snapshots {
+		mileage := snapshot.Vehicle.Status.CurrentMileage.Distance()
+		if mileage.Units == "" {
+			continue
+		}
+		if n := len(readings); n > 0 && readings[n-1].Mileage == mileage {
+			continue
+		}
+
+		readings = append(readings, connecteddrive.MileageReading{At: snapshot.At, Mileage: mileage})
+	}
+
+	return readings, nil
+}
+
+func (s *Store) FuelOverTime(vin string, from time.Time, to time.Time) ([]FuelReading, error) {
+	snapshots, err := s.Snapshots(vin, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	readings := make([]FuelReading, 0, len(snapshots))
+	for _, snapshot := range snapshots {
+		p := snapshot.Vehicle.Properties
+		r := FuelReading{
+			At:       snapshot.At,
+			Level:    p.FuelLevel,
+			Range:    p.CombustionRange.Distance,
+			Mileage:  snapshot.Vehicle.Status.CurrentMileage.Distance(),
+			InMotion: p.InMotion,
+		}
+		r.Location.Latitude = p.VehicleLocation.Coordinates.Latitude
+		r.Location.Longitude = p.VehicleLocation.Coordinates.Longitude
+		readings = append(readings, r)
+	}
+
+	return readings, nil
+}
+
+// LockStateTimeline returns the snapshots at which the lock state or the open openings changed.
+func (s *Store) LockStateTimeline(vin string, from time.Time, to time.Time) ([]LockStateChange, error) {
+	snapshots, err := s.Snapshots(vin, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	var timeline []LockStateChange
+	for _, snapshot := range snapshots {
+		v := snapshot.Vehicle
+		change := LockStateChange{
+			At:             snapshot.At,
+			State:          v.Status.DoorsGeneralState,
+			AreDoorsLocked: v.Properties.AreDoorsLocked,
+			IsSecure:       v.IsSecure(),
+			OpenOpenings:   v.OpenOpenings(),
+		}
+
+		if n := len(timeline); n > 0 && sameLockState(timeline[n-1], change) {
+			continue
+		}
+		timeline = append(timeline, change)
+	}
+
+	return timeline, nil
+}
+
+func sameLockState(a LockStateChange, b LockStateChange) bool {
+	if a.State != b.State || a.AreDoorsLocked != b.AreDoorsLocked || len(a.OpenOpenings) != len(b.OpenOpenings) {
+		return false
+	}
+
+	for i := range a.OpenOpenings {
+		if a.OpenOpenings[i] != b.OpenOpenings[i] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,398 @@
+package connected_drive
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	openIdConfigurationPath = "/.well-known/openid-configuration"
+	jwksCacheTtl            = 12 * time.Hour
+	jwksRefetchInterval     = time.Minute
+	idTokenClockSkew        = 5 * time.Minute
+	gcdmIssuer              = "https://customer.bmwgroup.com/gcdm"
+)
+
+var ErrNoIdToken = errors.New("no id token")
+
+type IdTokenClaims struct {
+	Issuer    string          `json:"iss"`
+	Subject   string          `json:"sub"`
+	Audience  json.RawMessage `json:"aud"`
+	ExpiresAt int64           `json:"exp"`
+	IssuedAt  int64           `json:"iat"`
+	Nonce     string          `json:"nonce"`
+	Gcid      string          `json:"gcid"`
+	Email     string          `json:"email"`
+	Name      string          `json:"name"`
+	GivenName string          `json:"given_name"`
+	Surname   string          `json:"family_name"`
+	Locale    string          `json:"locale"`
+	Country   string          `json:"country"`
+}
+
+func (c *IdTokenClaims) Audiences() []string {
+	var many []string
+	if json.Unmarshal(c.Audience, &many) == nil {
+		return many
+	}
+
+	var one string
+	if json.Unmarshal(c.Audience, &one) == nil && one != "" {
+		return []string{one}
+	}
+
+	return nil
+}
+
+type Account struct {
+	Gcid    string `json:"gcid"`
+	Email   string `json:"email"`
+	Name    string `json:"name"`
+	Locale  string `json:"locale"`
+	Country string `json:"country"`
+}
+
+func (c *IdTokenClaims) Account() *Account {
+	name := c.Name
+	if name == "" {
+		name = strings.TrimSpace(c.GivenName + " " + c.Surname)
+	}
+
+	country := c.Country
+	if country == "" {
+		if i := strings.IndexAny(c.Locale, "-_"); i >= 0 {
+			country = strings.ToUpper(c.Locale[i+1:])
+		}
+	}
+
+	return &Account{
+		Gcid:    firstNonEmpty(c.Gcid, c.Subject),
+		Email:   c.Email,
+		Name:    name,
+		Locale:  c.Locale,
+		Country: country,
+	}
+}
+
+type jwtHeader struct {
+	Algorithm string `json:"alg"`
+	KeyId     string `json:"kid"`
+}
+
+// ParseIdToken decodes the claims of an ID token without verifying its signature.
+func ParseIdToken(idToken string) (*IdTokenClaims, error) {
+	_, claims, _, err := splitJwt(idToken)
+
+	return claims, err
+}
+
+func splitJwt(token string) (*jwtHeader, *IdTokenClaims, []byte, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, nil, nil, fmt.Errorf("malformed id token: expected 3 parts, got %d", len(parts))
+	}
+
+	headerJson, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("malformed id token header: %w", err)
+	}
+	header := new(jwtHeader)
+	err = json.Unmarshal(headerJson, header)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("malformed id token header: %w", err)
+	}
+
+	claimsJson, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("malformed id token claims: %w", err)
+	}
+	claims := new(IdTokenClaims)
+	err = json.Unmarshal(claimsJson, claims)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("malformed id token claims: %w", err)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("malformed id token signature: %w", err)
+	}
+
+	return header, claims, signature, nil
+}
+
+type jwk struct {
+	KeyType string `json:"kty"`
+	KeyId   string `json:"kid"`
+	Use     string `json:"use"`
+	N       string `json:"n"`
+	E       string `json:"e"`
+	Curve   string `json:"crv"`
+	X       string `json:"x"`
+	Y       string `json:"y"`
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.KeyType {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Curve {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Curve)
+		}
+
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported key type %q", k.KeyType)
+}
+
+// IdTokenVerifier verifies ID token signatures with the keys published by the expected issuer. Keys are
+// discovered through the issuer's OpenID configuration and cached; tokens of any other issuer are rejected
+// before anything is fetched.
+type IdTokenVerifier struct {
+	httpClient  *http.Client
+	issuer      string
+	clientId    string
+	keys        map[string]crypto.PublicKey
+	fetchedAt   time.Time
+	refetchedAt time.Time
+	mutex       *sync.Mutex
+}
+
+// NewIdTokenVerifier creates a verifier accepting tokens of issuer issued for the audience client id. Empty
+// values default to the rest-of-world GCDM issuer and client.
+func NewIdTokenVerifier(httpClient *http.Client, issuer string, audience string) *IdTokenVerifier {
+	if issuer == "" {
+		issuer = gcdmIssuer
+	}
+	if audience == "" {
+		audience = clientId
+	}
+
+	return &IdTokenVerifier{
+		httpClient: httpClient,
+		issuer:     strings.TrimSuffix(issuer, "/"),
+		clientId:   audience,
+		mutex:      &sync.Mutex{},
+	}
+}
+
+// Verify checks issuer, signature, audience and expiry of the ID token and returns its claims.
+// An empty nonce is not checked.
+func (v *IdTokenVerifier) Verify(ctx context.Context, idToken string, nonce string) (*IdTokenClaims, error) {
+	return v.verify(ctx, idToken, nonce, true)
+}
+
+func (v *IdTokenVerifier) verify(ctx context.Context, idToken string, nonce string, checkExpiry bool) (*IdTokenClaims, error) {
+	header, claims, signature, err := splitJwt(idToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.TrimSuffix(claims.Issuer, "/") != v.issuer {
+		return nil, fmt.Errorf("id token is issued by %q, expected %s", claims.Issuer, v.issuer)
+	}
+
+	key, err := v.key(ctx, header.KeyId)
+	if err != nil {
+		return nil, err
+	}
+
+	signed := idToken[:strings.LastIndex(idToken, ".")]
+	err = verifySignature(header.Algorithm, key, []byte(signed), signature)
+	if err != nil {
+		return nil, fmt.Errorf("invalid id token signature: %w", err)
+	}
+
+	found := false
+	for _, aud := range claims.Audiences() {
+		found = found || aud == v.clientId
+	}
+	if !found {
+		return nil, fmt.Errorf("id token is not issued for client %s", v.clientId)
+	}
+
+	if checkExpiry && claims.ExpiresAt != 0 && time.Now().Add(-idTokenClockSkew).Unix() > claims.ExpiresAt {
+		return nil, fmt.Errorf("id token expired at %s", time.Unix(claims.ExpiresAt, 0))
+	}
+
+	if nonce != "" && claims.Nonce != nonce {
+		return nil, fmt.Errorf("id token nonce mismatch")
+	}
+
+	return claims, nil
+}
+
+func (v *IdTokenVerifier) key(ctx context.Context, keyId string) (crypto.PublicKey, error) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	expired := v.keys == nil || time.Since(v.fetchedAt) >= jwksCacheTtl
+	if key, ok := v.keys[keyId]; ok && !expired {
+		return key, nil
+	}
+
+	// unknown key ids trigger a refetch to pick up rotated keys, at most once per jwksRefetchInterval
+	if expired || time.Since(v.refetchedAt) >= jwksRefetchInterval {
+		v.refetchedAt = time.Now()
+
+		keys, err := v.fetchKeys(ctx, v.issuer)
+		if err != nil {
+			return nil, err
+		}
+		v.keys = keys
+		v.fetchedAt = time.Now()
+	}
+
+	key, ok := v.keys[keyId]
+	if !ok {
+		return nil, fmt.Errorf("issuer %s has no key %q", v.issuer, keyId)
+	}
+
+	return key, nil
+}
+
+func (v *IdTokenVerifier) fetchKeys(ctx context.Context, issuer string) (map[string]crypto.PublicKey, error) {
+	var configuration struct {
+		JwksUri string `json:"jwks_uri"`
+	}
+	err := v.getJson(ctx, strings.TrimSuffix(issuer, "/")+openIdConfigurationPath, &configuration)
+	if err != nil {
+		return nil, fmt.Errorf("can't fetch OpenID configuration of %s: %w", issuer, err)
+	}
+	if configuration.JwksUri == "" {
+		return nil, fmt.Errorf("OpenID configuration of %s has no jwks_uri", issuer)
+	}
+
+	var jwks struct {
+		Keys []jwk `json:"keys"`
+	}
+	err = v.getJson(ctx, configuration.JwksUri, &jwks)
+	if err != nil {
+		return nil, fmt.Errorf("can't fetch keys of %s: %w", issuer, err)
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	for _, k := range jwks.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		key, err := k.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[k.KeyId] = key
+	}
+
+	return keys, nil
+}
+
+func (v *IdTokenVerifier) getJson(ctx context.Context, endpoint string, target interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := v.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer func(body io.ReadCloser) {
+		_ = body.Close()
+	}(resp.Body)
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(target)
+}
+
+func verifySignature(algorithm string, key crypto.PublicKey, signed []byte, signature []byte) error {
+	if len(algorithm) != 5 {
+		return fmt.Errorf("unsupported algorithm %q", algorithm)
+	}
+
+	var h hash.Hash
+	var hashType crypto.Hash
+	switch algorithm[2:] {
+	case "256":
+		h, hashType = sha256.New(), crypto.SHA256
+	case "384":
+		h, hashType = sha512.New384(), crypto.SHA384
+	case "512":
+		h, hashType = sha512.New(), crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported algorithm %q", algorithm)
+	}
+	h.Write(signed)
+	digest := h.Sum(nil)
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		switch algorithm[:2] {
+		case "RS":
+			return rsa.VerifyPKCS1v15(k, hashType, digest, signature)
+		case "PS":
+			return rsa.VerifyPSS(k, hashType, digest, signature, nil)
+		}
+	case *ecdsa.PublicKey:
+		if algorithm[:2] == "ES" {
+			size := len(signature) / 2
+			r := new(big.Int).SetBytes(signature[:size])
+			s := new(big.Int).SetBytes(signature[size:])
+			if !ecdsa.Verify(k, digest, r, s) {
+				return fmt.Errorf("ecdsa verification failed")
+			}
+
+			return nil
+		}
+	}
+
+	return fmt.Errorf("algorithm %q does not match key type %T", algorithm, key)
+}
@@ -0,0 +1,190 @@
+package connected_drive
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+const vehicleImageRequestUrl = "https://cocoapi.bmwgroup.com/eadrax-ics/v3/presentation/vehicles/images?carView=%s"
+
+type ImageView string
+
+const (
+	ImageViewFrontSide ImageView = "AngleSideViewForty"
+	ImageViewFront     ImageView = "FrontView"
+	ImageViewRear      ImageView = "RearView"
+	ImageViewSide      ImageView = "SideViewLeft"
+	ImageViewDashboard ImageView = "Dashboard"
+)
+
+type VehicleImage struct {
+	Data        []byte `json:"-"`
+	ContentType string `json:"contentType"`
+	ETag        string `json:"etag"`
+}
+
+func WithImageCache(dir string) ClientOption {
+	return func(c *Client) {
+		c.imageCacheDir = dir
+	}
+}
+
+// GetVehicleImage fetches a rendered picture of the vehicle. With an image cache configured the picture is
+// stored on disk and revalidated with its ETag on subsequent calls.
+func (c *Client) GetVehicleImage(ctx context.Context, vin string, view ImageView) (image *VehicleImage, err error) {
+	ctx, op := c.startOperation(ctx, "GetVehicleImage", Attr(AttrVinHash, HashVin(vin)))
+	defer func() { op.end(err) }()
+
+	err = c.refreshAuth(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error refreshing auth while fetching vehicle image: %w", err)
+	}
+
+	cached := c.loadCachedImage(vin, view)
+
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodGet,
+		fmt.Sprintf(vehicleImageRequestUrl, url.QueryEscape(string(view))),
+		nil,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error creating vehicle image request: %w", err)
+	}
+
+	req.Header = c.apiHeader()
+	req.Header.Set("Accept", "image/png")
+	req.Header.Set("bmw-vin", vin)
+	if cached != nil && cached.ETag != "" {
+		req.Header.Set("If-None-Match", cached.ETag)
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching vehicle image: %w", err)
+	}
+
+	defer func(body io.ReadCloser) {
+		_ = body.Close()
+	}(resp.Body)
+
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		return cached, nil
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return nil, fmt.Errorf("error fetching vehicle image: %v", resp)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading vehicle image: %w", err)
+	}
+
+	image = &VehicleImage{
+		Data:        data,
+		ContentType: resp.Header.Get("Content-Type"),
+		ETag:        resp.Header.Get("ETag"),
+	}
+	if image.ContentType == "" {
+		image.ContentType = http.DetectContentType(data)
+	}
+
+	// the image was downloaded, a cache that can't be written only costs a download next time
+	cacheErr := c.saveCachedImage(vin, view, image)
+	if cacheErr != nil {
+		c.log(ctx, LogLevelWarn, "caching vehicle image failed", "vin", vin, "error", cacheErr)
+	}
+
+	return image, nil
+}
+
+// imageCachePath names cache files by a hash of VIN and view, so that caller-supplied values can't leave the
+// cache directory and VINs don't appear in file names.
+func (c *Client) imageCachePath(vin string, view ImageView) string {
+	sum := sha256.Sum256([]byte(vin + "\x00" + string(view)))
+
+	return filepath.Join(c.imageCacheDir, hex.EncodeToString(sum[:16]))
+}
+
+func (c *Client) loadCachedImage(vin string, view ImageView) *VehicleImage {
+	if c.imageCacheDir == "" {
+		return nil
+	}
+
+	path := c.imageCachePath(vin, view)
+	meta, err := os.ReadFile(path + ".json")
+	if err != nil {
+		return nil
+	}
+
+	image := new(VehicleImage)
+	err = json.Unmarshal(meta, image)
+	if err != nil {
+		return nil
+	}
+
+	image.Data, err = os.ReadFile(path + ".img")
+	if err != nil {
+		return nil
+	}
+
+	return image
+}
+
+func (c *Client) saveCachedImage(vin string, view ImageView, image *VehicleImage) error {
+	if c.imageCacheDir == "" {
+		return nil
+	}
+
+	err := os.MkdirAll(c.imageCacheDir, 0o755)
+	if err != nil {
+		return err
+	}
+
+	meta, err := json.Marshal(image)
+	if err != nil {
+		return err
+	}
+
+	path := c.imageCachePath(vin, view)
+	err = writeFileAtomic(path+".img", image.Data, 0o644)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(path+".json", meta, 0o644)
+}
+
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), perm)
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+	}
+
+	return err
+}
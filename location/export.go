@@ -0,0 +1,372 @@
+package location
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+
+	connecteddrive "github.com/sdrobov/connected-drive"
+)
+
+const (
+	gpxCreator     = "github.com/sdrobov/connected-drive"
+	gpxNamespace   = "http://www.topografix.com/GPX/1/1"
+	kmlNamespace   = "http://www.opengis.net/kml/2.2"
+	exportTimeJson = time.RFC3339
+)
+
+type vehicleFeature struct {
+	point      Point
+	properties map[string]interface{}
+}
+
+func vehicleFeatures(vehicles connecteddrive.Vehicles) []vehicleFeature {
+	var features []vehicleFeature
+	for _, v := range vehicles {
+		if v == nil {
+			continue
+		}
+
+		p, ok := PointFromVehicle(v)
+		if !ok {
+			continue
+		}
+
+		features = append(features, vehicleFeature{
+			point: p,
+			properties: map[string]interface{}{
+				"vin":       v.Vin,
+				"model":     v.Model,
+				"brand":     v.Brand,
+				"heading":   p.Heading,
+				"address":   p.Address,
+				"fuelLevel": v.Properties.FuelLevel.Value,
+				"fuelUnits": v.Properties.FuelLevel.Units,
+				"lockState": string(v.Status.DoorsGeneralState),
+				"isSecure":  v.IsSecure(),
+				"updatedAt": p.At.Format(exportTimeJson),
+			},
+		})
+	}
+
+	return features
+}
+
+// tracks groups points by VIN, each track ordered by time.
+func tracks(points []Point) (vins []string, byVin map[string][]Point) {
+	byVin = make(map[string][]Point)
+	for _, p := range points {
+		if _, ok := byVin[p.Vin]; !ok {
+			vins = append(vins, p.Vin)
+		}
+		byVin[p.Vin] = append(byVin[p.Vin], p)
+	}
+
+	sort.Strings(vins)
+	for _, track := range byVin {
+		sort.SliceStable(track, func(i, j int) bool {
+			return track[i].At.Before(track[j].At)
+		})
+	}
+
+	return vins, byVin
+}
+
+type geoJsonGeometry struct {
+	Type        string      `json:"type"`
+	Coordinates interface{} `json:"coordinates"`
+}
+
+type geoJsonFeature struct {
+	Type       string                 `json:"type"`
+	Geometry   geoJsonGeometry        `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+type geoJsonFeatureCollection struct {
+	Type     string           `json:"type"`
+	Features []geoJsonFeature `json:"features"`
+}
+
+func writeGeoJson(w io.Writer, features []geoJsonFeature) error {
+	if features == nil {
+		features = []geoJsonFeature{}
+	}
+
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	err := e.Encode(geoJsonFeatureCollection{Type: "FeatureCollection", Features: features})
+	if err != nil {
+		return fmt.Errorf("error encoding GeoJSON: %w", err)
+	}
+
+	return nil
+}
+
+// WriteVehiclesGeoJSON writes the current vehicle positions as a FeatureCollection of Points.
+func WriteVehiclesGeoJSON(w io.Writer, vehicles connecteddrive.Vehicles) error {
+	var features []geoJsonFeature
+	for _, f := range vehicleFeatures(vehicles) {
+		features = append(features, geoJsonFeature{
+			Type: "Feature",
+			Geometry: geoJsonGeometry{
+				Type:        "Point",
+				Coordinates: []float64{f.point.Longitude, f.point.Latitude},
+			},
+			Properties: f.properties,
+		})
+	}
+
+	return writeGeoJson(w, features)
+}
+
+// WriteHistoryGeoJSON writes one LineString per vehicle. Vehicles with a single point are written as Points.
+func WriteHistoryGeoJSON(w io.Writer, points []Point) error {
+	vins, byVin := tracks(points)
+
+	var features []geoJsonFeature
+	for _, vin := range vins {
+		track := byVin[vin]
+		coordinates := make([][]float64, 0, len(track))
+		times := make([]string, 0, len(track))
+		for _, p := range track {
+			coordinates = append(coordinates, []float64{p.Longitude, p.Latitude})
+			times = append(times, p.At.Format(exportTimeJson))
+		}
+
+		geometry := geoJsonGeometry{Type: "LineString", Coordinates: coordinates}
+		if len(coordinates) == 1 {
+			geometry = geoJsonGeometry{Type: "Point", Coordinates: coordinates[0]}
+		}
+
+		features = append(features, geoJsonFeature{
+			Type:     "Feature",
+			Geometry: geometry,
+			Properties: map[string]interface{}{
+				"vin":   vin,
+				"from":  times[0],
+				"to":    times[len(times)-1],
+				"times": times,
+			},
+		})
+	}
+
+	return writeGeoJson(w, features)
+}
+
+type gpxWaypoint struct {
+	Latitude  float64 `xml:"lat,attr"`
+	Longitude float64 `xml:"lon,attr"`
+	Time      string  `xml:"time,omitempty"`
+	Name      string  `xml:"name,omitempty"`
+	Desc      string  `xml:"desc,omitempty"`
+	Course    string  `xml:"extensions>course,omitempty"`
+}
+
+type gpxTrack struct {
+	Name   string        `xml:"name"`
+	Points []gpxWaypoint `xml:"trkseg>trkpt"`
+}
+
+type gpx struct {
+	XMLName   xml.Name      `xml:"gpx"`
+	Xmlns     string        `xml:"xmlns,attr"`
+	Version   string        `xml:"version,attr"`
+	Creator   string        `xml:"creator,attr"`
+	Waypoints []gpxWaypoint `xml:"wpt"`
+	Tracks    []gpxTrack    `xml:"trk"`
+}
+
+func writeXml(w io.Writer, v interface{}) error {
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+
+	e := xml.NewEncoder(w)
+	e.Indent("", "  ")
+	err = e.Encode(v)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, "\n")
+
+	return err
+}
+
+// WriteVehiclesGPX writes the current vehicle positions as GPX waypoints named by VIN.
+func WriteVehiclesGPX(w io.Writer, vehicles connecteddrive.Vehicles) error {
+	doc := gpx{Xmlns: gpxNamespace, Version: "1.1", Creator: gpxCreator}
+	for _, f := range vehicleFeatures(vehicles) {
+		doc.Waypoints = append(doc.Waypoints, gpxWaypoint{
+			Latitude:  f.point.Latitude,
+			Longitude: f.point.Longitude,
+			Time:      f.point.At.UTC().Format(time.RFC3339),
+			Name:      f.point.Vin,
+			Desc:      describe(f.properties),
+			Course:    strconv.Itoa(f.point.Heading),
+		})
+	}
+
+	err := writeXml(w, doc)
+	if err != nil {
+		return fmt.Errorf("error encoding GPX: %w", err)
+	}
+
+	return nil
+}
+
+// WriteHistoryGPX writes one track per vehicle.
+func WriteHistoryGPX(w io.Writer, points []Point) error {
+	doc := gpx{Xmlns: gpxNamespace, Version: "1.1", Creator: gpxCreator}
+	vins, byVin := tracks(points)
+	for _, vin := range vins {
+		track := gpxTrack{Name: vin}
+		for _, p := range byVin[vin] {
+			track.Points = append(track.Points, gpxWaypoint{
+				Latitude:  p.Latitude,
+				Longitude: p.Longitude,
+				Time:      p.At.UTC().Format(time.RFC3339),
+				Course:    strconv.Itoa(p.Heading),
+			})
+		}
+		doc.Tracks = append(doc.Tracks, track)
+	}
+
+	err := writeXml(w, doc)
+	if err != nil {
+		return fmt.Errorf("error encoding GPX: %w", err)
+	}
+
+	return nil
+}
+
+type kmlData struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value"`
+}
+
+type kmlPlacemark struct {
+	Name         string    `xml:"name"`
+	Description  string    `xml:"description,omitempty"`
+	TimeStamp    string    `xml:"TimeStamp>when,omitempty"`
+	ExtendedData []kmlData `xml:"ExtendedData>Data,omitempty"`
+	Point        *struct {
+		Coordinates string `xml:"coordinates"`
+	} `xml:"Point,omitempty"`
+	LineString *struct {
+		Tessellate  int    `xml:"tessellate"`
+		Coordinates string `xml:"coordinates"`
+	} `xml:"LineString,omitempty"`
+}
+
+type kml struct {
+	XMLName    xml.Name       `xml:"kml"`
+	Xmlns      string         `xml:"xmlns,attr"`
+	Name       string         `xml:"Document>name"`
+	Placemarks []kmlPlacemark `xml:"Document>Placemark"`
+}
+
+// WriteVehiclesKML writes the current vehicle positions as placemarks with the vehicle details as extended data.
+func WriteVehiclesKML(w io.Writer, vehicles connecteddrive.Vehicles) error {
+	doc := kml{Xmlns: kmlNamespace, Name: "Vehicles"}
+	for _, f := range vehicleFeatures(vehicles) {
+		placemark := kmlPlacemark{
+			Name:        f.point.Vin,
+			Description: f.point.Address,
+			TimeStamp:   f.point.At.UTC().Format(time.RFC3339),
+			Point: &struct {
+				Coordinates string `xml:"coordinates"`
+			}{Coordinates: kmlCoordinates(f.point)},
+		}
+		for _, key := range sortedKeys(f.properties) {
+			placemark.ExtendedData = append(placemark.ExtendedData, kmlData{
+				Name:  key,
+				Value: fmt.Sprint(f.properties[key]),
+			})
+		}
+		doc.Placemarks = append(doc.Placemarks, placemark)
+	}
+
+	err := writeXml(w, doc)
+	if err != nil {
+		return fmt.Errorf("error encoding KML: %w", err)
+	}
+
+	return nil
+}
+
+// WriteHistoryKML writes one LineString placemark per vehicle.
+func WriteHistoryKML(w io.Writer, points []Point) error {
+	doc := kml{Xmlns: kmlNamespace, Name: "Location history"}
+	vins, byVin := tracks(points)
+	for _, vin := range vins {
+		track := byVin[vin]
+		if len(track) == 1 {
+			// a LineString needs at least two coordinates
+			doc.Placemarks = append(doc.Placemarks, kmlPlacemark{
+				Name:      vin,
+				TimeStamp: track[0].At.UTC().Format(time.RFC3339),
+				Point: &struct {
+					Coordinates string `xml:"coordinates"`
+				}{Coordinates: kmlCoordinates(track[0])},
+			})
+
+			continue
+		}
+
+		coordinates := ""
+		for i, p := range track {
+			if i > 0 {
+				coordinates += " "
+			}
+			coordinates += kmlCoordinates(p)
+		}
+
+		doc.Placemarks = append(doc.Placemarks, kmlPlacemark{
+			Name: vin,
+			LineString: &struct {
+				Tessellate  int    `xml:"tessellate"`
+				Coordinates string `xml:"coordinates"`
+			}{Tessellate: 1, Coordinates: coordinates},
+		})
+	}
+
+	err := writeXml(w, doc)
+	if err != nil {
+		return fmt.Errorf("error encoding KML: %w", err)
+	}
+
+	return nil
+}
+
+func kmlCoordinates(p Point) string {
+	return strconv.FormatFloat(p.Longitude, 'f', -1, 64) + "," + strconv.FormatFloat(p.Latitude, 'f', -1, 64)
+}
+
+func describe(properties map[string]interface{}) string {
+	description := ""
+	for _, key := range sortedKeys(properties) {
+		if description != "" {
+			description += ", "
+		}
+		description += fmt.Sprintf("%s: %v", key, properties[key])
+	}
+
+	return description
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
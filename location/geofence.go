@@ -0,0 +1,150 @@
+package location
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sdrobov/connected-drive/internal/geo"
+)
+
+type Zone interface {
+	Name() string
+	Contains(latitude float64, longitude float64) bool
+}
+
+type Circle struct {
+	Id           string  `json:"id"`
+	Latitude     float64 `json:"latitude"`
+	Longitude    float64 `json:"longitude"`
+	RadiusMeters float64 `json:"radiusMeters"`
+}
+
+func (c *Circle) Name() string {
+	return c.Id
+}
+
+func (c *Circle) Contains(latitude float64, longitude float64) bool {
+	return geo.Haversine(c.Latitude, c.Longitude, latitude, longitude) <= c.RadiusMeters
+}
+
+type Coordinate struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// Polygon is a zone bounded by a closed ring of coordinates. It is evaluated on a plane, which is accurate
+// enough for depots and countries not crossing the antimeridian.
+type Polygon struct {
+	Id     string       `json:"id"`
+	Points []Coordinate `json:"points"`
+}
+
+func (p *Polygon) Name() string {
+	return p.Id
+}
+
+func (p *Polygon) Contains(latitude float64, longitude float64) bool {
+	inside := false
+	for i, j := 0, len(p.Points)-1; i < len(p.Points); j, i = i, i+1 {
+		a, b := p.Points[i], p.Points[j]
+		if (a.Latitude > latitude) != (b.Latitude > latitude) &&
+			longitude < (b.Longitude-a.Longitude)*(latitude-a.Latitude)/(b.Latitude-a.Latitude)+a.Longitude {
+			inside = !inside
+		}
+	}
+
+	return inside
+}
+
+type EventType string
+
+const (
+	EventEnter EventType = "ENTER"
+	EventExit  EventType = "EXIT"
+)
+
+type Event struct {
+	Type  EventType `json:"type"`
+	Vin   string    `json:"vin"`
+	Zone  string    `json:"zone"`
+	At    time.Time `json:"at"`
+	Point Point     `json:"point"`
+}
+
+type zoneState struct {
+	inside bool
+	since  time.Time
+}
+
+// Engine tracks which zones each vehicle is in. The first location of a vehicle only initialises its
+// state; events are emitted on subsequent transitions.
+type Engine struct {
+	zones  []Zone
+	states map[string]map[string]*zoneState
+	mutex  *sync.Mutex
+}
+
+func NewEngine(zones ...Zone) *Engine {
+	return &Engine{
+		zones:  zones,
+		states: make(map[string]map[string]*zoneState),
+		mutex:  &sync.Mutex{},
+	}
+}
+
+func (e *Engine) AddZone(z Zone) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.zones = append(e.zones, z)
+}
+
+func (e *Engine) Update(p Point) []Event {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	states, ok := e.states[p.Vin]
+	if !ok {
+		states = make(map[string]*zoneState)
+		e.states[p.Vin] = states
+	}
+
+	var events []Event
+	for _, z := range e.zones {
+		inside := z.Contains(p.Latitude, p.Longitude)
+		s, ok := states[z.Name()]
+		if !ok {
+			states[z.Name()] = &zoneState{inside: inside, since: p.At}
+
+			continue
+		}
+		if s.inside == inside {
+			continue
+		}
+
+		s.inside = inside
+		s.since = p.At
+
+		eventType := EventExit
+		if inside {
+			eventType = EventEnter
+		}
+		events = append(events, Event{Type: eventType, Vin: p.Vin, Zone: z.Name(), At: p.At, Point: p})
+	}
+
+	return events
+}
+
+// State reports whether the vehicle is inside the zone and since when. known is false before the
+// first location of the vehicle was seen.
+func (e *Engine) State(vin string, zone string) (inside bool, since time.Time, known bool) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	s, ok := e.states[vin][zone]
+	if !ok {
+		return false, time.Time{}, false
+	}
+
+	return s.inside, s.since, true
+}
@@ -0,0 +1,193 @@
+package location
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	connecteddrive "github.com/sdrobov/connected-drive"
+)
+
+type Point struct {
+	Vin       string    `json:"vin"`
+	At        time.Time `json:"at"`
+	Latitude  float64   `json:"latitude"`
+	Longitude float64   `json:"longitude"`
+	Heading   int       `json:"heading"`
+	Address   string    `json:"address,omitempty"`
+}
+
+// PointFromVehicle returns the current location of the vehicle. ok is false when the vehicle reports no location.
+func PointFromVehicle(v *connecteddrive.Vehicle) (p Point, ok bool) {
+	l := v.Properties.VehicleLocation
+	if l.Coordinates.Latitude == 0 && l.Coordinates.Longitude == 0 {
+		return Point{}, false
+	}
+
+	at := v.Properties.LastUpdatedAt
+	if at.IsZero() {
+		at = v.Status.LastUpdatedAt
+	}
+
+	return Point{
+		Vin:       v.Vin,
+		At:        at,
+		Latitude:  l.Coordinates.Latitude,
+		Longitude: l.Coordinates.Longitude,
+		Heading:   l.Heading,
+		Address:   l.Address.Formatted,
+	}, true
+}
+
+type Store interface {
+	Append(ctx context.Context, p Point) error
+	Last(ctx context.Context, vin string) (*Point, error)
+	History(ctx context.Context, vin string, from time.Time, to time.Time) ([]Point, error)
+}
+
+type MemoryStore struct {
+	points map[string][]Point
+	limit  int
+	mutex  *sync.RWMutex
+}
+
+// NewMemoryStore keeps up to limit points per vehicle, or all of them if limit is zero.
+func NewMemoryStore(limit int) *MemoryStore {
+	return &MemoryStore{
+		points: make(map[string][]Point),
+		limit:  limit,
+		mutex:  &sync.RWMutex{},
+	}
+}
+
+func (s *MemoryStore) Append(_ context.Context, p Point) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	points := append(s.points[p.Vin], p)
+	sort.SliceStable(points, func(i, j int) bool {
+		return points[i].At.Before(points[j].At)
+	})
+	if s.limit > 0 && len(points) > s.limit {
+		points = points[len(points)-s.limit:]
+	}
+	s.points[p.Vin] = points
+
+	return nil
+}
+
+func (s *MemoryStore) Last(_ context.Context, vin string) (*Point, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	points := s.points[vin]
+	if len(points) == 0 {
+		return nil, nil
+	}
+
+	p := points[len(points)-1]
+
+	return &p, nil
+}
+
+func (s *MemoryStore) History(_ context.Context, vin string, from time.Time, to time.Time) ([]Point, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	var points []Point
+	for _, p := range s.points[vin] {
+		if (from.IsZero() || !p.At.Before(from)) && (to.IsZero() || !p.At.After(to)) {
+			points = append(points, p)
+		}
+	}
+
+	return points, nil
+}
+
+type VehicleSource interface {
+	GetVehicles(ctx context.Context) (connecteddrive.Vehicles, error)
+}
+
+// Recorder stores the locations of vehicles and runs them through the geofence engine.
+// A location is stored only when it differs from the last stored one.
+type Recorder struct {
+	store   Store
+	engine  *Engine
+	onEvent func(Event)
+}
+
+func NewRecorder(store Store, engine *Engine, onEvent func(Event)) *Recorder {
+	return &Recorder{
+		store:   store,
+		engine:  engine,
+		onEvent: onEvent,
+	}
+}
+
+func (r *Recorder) Record(ctx context.Context, vehicles connecteddrive.Vehicles) ([]Event, error) {
+	var events []Event
+	for _, v := range vehicles {
+		if v == nil {
+			continue
+		}
+
+		p, ok := PointFromVehicle(v)
+		if !ok {
+			continue
+		}
+
+		last, err := r.store.Last(ctx, p.Vin)
+		if err != nil {
+			return events, fmt.Errorf("error loading last location of %s: %w", p.Vin, err)
+		}
+		if last != nil && last.At.Equal(p.At) && last.Latitude == p.Latitude && last.Longitude == p.Longitude {
+			continue
+		}
+
+		err = r.store.Append(ctx, p)
+		if err != nil {
+			return events, fmt.Errorf("error storing location of %s: %w", p.Vin, err)
+		}
+
+		if r.engine == nil {
+			continue
+		}
+
+		for _, e := range r.engine.Update(p) {
+			events = append(events, e)
+			if r.onEvent != nil {
+				r.onEvent(e)
+			}
+		}
+	}
+
+	return events, nil
+}
+
+// Run polls the source every interval until the context is done. Fetch errors are passed to onError
+// and do not stop the recorder.
+func (r *Recorder) Run(ctx context.Context, source VehicleSource, interval time.Duration, onError func(error)) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		vehicles, err := source.GetVehicles(ctx)
+		if err == nil || len(vehicles) > 0 {
+			_, recordErr := r.Record(ctx, vehicles)
+			if recordErr != nil && err == nil {
+				err = recordErr
+			}
+		}
+		if err != nil && onError != nil {
+			onError(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
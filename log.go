@@ -0,0 +1,212 @@
+package connected_drive
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+type LogLevel int
+
+const (
+	LogLevelDebug LogLevel = iota
+	LogLevelInfo
+	LogLevelWarn
+	LogLevelError
+)
+
+func (l LogLevel) String() string {
+	switch l {
+	case LogLevelDebug:
+		return "DEBUG"
+	case LogLevelInfo:
+		return "INFO"
+	case LogLevelWarn:
+		return "WARN"
+	case LogLevelError:
+		return "ERROR"
+	}
+
+	return fmt.Sprintf("LEVEL(%d)", int(l))
+}
+
+const redacted = "[REDACTED]"
+
+// Logger receives structured log records. keyvals alternate between string keys and values, as in log/slog,
+// so a *slog.Logger can be adapted with a few lines of code.
+type Logger interface {
+	Log(ctx context.Context, level LogLevel, msg string, keyvals ...interface{})
+}
+
+type LoggerFunc func(ctx context.Context, level LogLevel, msg string, keyvals ...interface{})
+
+func (f LoggerFunc) Log(ctx context.Context, level LogLevel, msg string, keyvals ...interface{}) {
+	f(ctx, level, msg, keyvals...)
+}
+
+// NewStdLogger writes records of at least minLevel as "LEVEL msg key=value ..." lines.
+func NewStdLogger(logger *log.Logger, minLevel LogLevel) Logger {
+	return LoggerFunc(func(_ context.Context, level LogLevel, msg string, keyvals ...interface{}) {
+		if level < minLevel {
+			return
+		}
+
+		b := &strings.Builder{}
+		b.WriteString(level.String())
+		b.WriteByte(' ')
+		b.WriteString(msg)
+		for i := 0; i+1 < len(keyvals); i += 2 {
+			_, _ = fmt.Fprintf(b, " %v=%q", keyvals[i], fmt.Sprint(keyvals[i+1]))
+		}
+
+		logger.Print(b.String())
+	})
+}
+
+// WithLogger enables logging of the auth stages, token refreshes and API calls. Secrets are always redacted,
+// VINs are redacted unless WithVinLogging is used.
+func WithLogger(logger Logger) ClientOption {
+	return func(c *Client) {
+		c.logger = logger
+	}
+}
+
+// WithVinLogging controls whether VINs appear unredacted in log records.
+func WithVinLogging(enabled bool) ClientOption {
+	return func(c *Client) {
+		c.logVins = enabled
+	}
+}
+
+const secretParams = "access_token|refresh_token|id_token|code|code_verifier|password|token|hcaptchatoken|state|nonce"
+
+var (
+	sensitiveLogKeys = map[string]bool{
+		"password":                  true,
+		"token":                     true,
+		"access_token":              true,
+		"refresh_token":             true,
+		"id_token":                  true,
+		"code":                      true,
+		"code_verifier":             true,
+		"authorization":             true,
+		"cookie":                    true,
+		"set-cookie":                true,
+		"hcaptchatoken":             true,
+		"captcha_token":             true,
+		"client_secret":             true,
+		"nonce":                     true,
+		"state":                     true,
+		"username":                  true,
+		"email":                     true,
+		"clientpassword":            true,
+		strings.ToLower(gcdmCookie): true,
+	}
+
+	secretPatterns = []*regexp.Regexp{
+		regexp.MustCompile(`(?i)((?:bearer|basic)\s+)[A-Za-z0-9._~+/=-]+`),
+		regexp.MustCompile(`(?i)(` + gcdmCookie + `=)[^;\s&"]+`),
+		regexp.MustCompile(`((?:` + secretParams + `)=|"(?:` + secretParams + `)"\s*:\s*")[^&\s"]+`),
+	}
+	vinPattern = regexp.MustCompile(`\b[A-HJ-NPR-Z0-9]{17}\b`)
+)
+
+// redactingLogger scrubs secrets, and optionally VINs, from the records before passing them on.
+type redactingLogger struct {
+	next    Logger
+	logVins bool
+}
+
+func newRedactingLogger(next Logger, logVins bool) Logger {
+	if next == nil {
+		return nil
+	}
+	if _, ok := next.(*redactingLogger); ok {
+		return next
+	}
+
+	return &redactingLogger{next: next, logVins: logVins}
+}
+
+func (l *redactingLogger) Log(ctx context.Context, level LogLevel, msg string, keyvals ...interface{}) {
+	scrubbed := make([]interface{}, len(keyvals))
+	for i := 0; i < len(keyvals); i++ {
+		if i%2 == 0 {
+			scrubbed[i] = keyvals[i]
+
+			continue
+		}
+
+		key := strings.ToLower(fmt.Sprint(keyvals[i-1]))
+		switch {
+		case sensitiveLogKeys[key]:
+			scrubbed[i] = redacted
+		case key == "vin" && !l.logVins:
+			scrubbed[i] = redactVin(fmt.Sprint(keyvals[i]))
+		default:
+			scrubbed[i] = l.redactValue(keyvals[i])
+		}
+	}
+
+	l.next.Log(ctx, level, l.redactString(msg), scrubbed...)
+}
+
+func (l *redactingLogger) redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil, bool, int, int64, float64, time.Duration, time.Time, LogLevel:
+		return v
+	case error:
+		return l.redactString(v.Error())
+	case fmt.Stringer:
+		return l.redactString(v.String())
+	case string:
+		return l.redactString(v)
+	}
+
+	return l.redactString(fmt.Sprint(value))
+}
+
+func (l *redactingLogger) redactString(s string) string {
+	for _, p := range secretPatterns {
+		s = p.ReplaceAllString(s, "${1}"+redacted)
+	}
+	if !l.logVins {
+		s = vinPattern.ReplaceAllStringFunc(s, redactVin)
+	}
+
+	return s
+}
+
+// redactVin keeps the last four characters, enough to tell the vehicles of an account apart.
+func redactVin(vin string) string {
+	if len(vin) <= 4 {
+		return redacted
+	}
+
+	return strings.Repeat("*", len(vin)-4) + vin[len(vin)-4:]
+}
+
+// logUrl strips the query, which carries codes and tokens in the auth flow.
+func logUrl(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+	stripped := *u
+	stripped.RawQuery = ""
+	stripped.Fragment = ""
+	stripped.User = nil
+
+	return stripped.String()
+}
+
+func (c *Client) log(ctx context.Context, level LogLevel, msg string, keyvals ...interface{}) {
+	if c.logger == nil {
+		return
+	}
+
+	c.logger.Log(ctx, level, msg, keyvals...)
+}
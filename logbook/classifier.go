@@ -0,0 +1,46 @@
+package logbook
+
+import (
+	connecteddrive "github.com/sdrobov/connected-drive"
+	"github.com/sdrobov/connected-drive/internal/geo"
+)
+
+type Place struct {
+	Name         string  `json:"name"`
+	Latitude     float64 `json:"latitude"`
+	Longitude    float64 `json:"longitude"`
+	RadiusMeters float64 `json:"radiusMeters"`
+}
+
+func (p Place) Contains(l connecteddrive.TripLocation) bool {
+	return geo.Haversine(p.Latitude, p.Longitude, l.Latitude, l.Longitude) <= p.RadiusMeters
+}
+
+// PlaceClassifier marks trips between home and work as commute and trips starting or ending at one of the
+// business places as business. Everything else gets the default purpose.
+type PlaceClassifier struct {
+	Home     Place
+	Work     Place
+	Business []Place
+	Default  Purpose
+}
+
+func (c *PlaceClassifier) Classify(trip *connecteddrive.Trip) (Purpose, string) {
+	start, end := trip.StartLocation, trip.EndLocation
+
+	if (c.Home.Contains(start) && c.Work.Contains(end)) || (c.Work.Contains(start) && c.Home.Contains(end)) {
+		return PurposeCommute, ""
+	}
+
+	for _, p := range c.Business {
+		if p.Contains(start) || p.Contains(end) {
+			return PurposeBusiness, p.Name
+		}
+	}
+
+	if c.Default == "" {
+		return PurposePrivate, ""
+	}
+
+	return c.Default, ""
+}
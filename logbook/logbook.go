@@ -0,0 +1,509 @@
+package logbook
+
+import (
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	connecteddrive "github.com/sdrobov/connected-drive"
+)
+
+type Purpose string
+
+const (
+	PurposeBusiness Purpose = "BUSINESS"
+	PurposePrivate  Purpose = "PRIVATE"
+	PurposeCommute  Purpose = "COMMUTE"
+)
+
+type EntryKind string
+
+const (
+	EntryKindTrip       EntryKind = "TRIP"
+	EntryKindCorrection EntryKind = "CORRECTION"
+)
+
+type Entry struct {
+	Sequence        int       `json:"sequence"`
+	Kind            EntryKind `json:"kind"`
+	RecordedAt      time.Time `json:"recordedAt"`
+	Vin             string    `json:"vin"`
+	TripId          string    `json:"tripId,omitempty"`
+	StartTime       time.Time `json:"startTime"`
+	EndTime         time.Time `json:"endTime"`
+	StartAddress    string    `json:"startAddress"`
+	EndAddress      string    `json:"endAddress"`
+	OdometerStartKm float64   `json:"odometerStartKm"`
+	OdometerEndKm   float64   `json:"odometerEndKm"`
+	DistanceKm      float64   `json:"distanceKm"`
+	Purpose         Purpose   `json:"purpose"`
+	Note            string    `json:"note,omitempty"`
+	Driver          string    `json:"driver,omitempty"`
+	Corrects        int       `json:"corrects,omitempty"`
+	PrevHash        string    `json:"prevHash"`
+	Hash            string    `json:"hash"`
+}
+
+func (e *Entry) computeHash() string {
+	fields := []string{
+		strconv.Itoa(e.Sequence),
+		string(e.Kind),
+		formatTime(e.RecordedAt),
+		e.Vin,
+		e.TripId,
+		formatTime(e.StartTime),
+		formatTime(e.EndTime),
+		e.StartAddress,
+		e.EndAddress,
+		formatKm(e.OdometerStartKm),
+		formatKm(e.OdometerEndKm),
+		formatKm(e.DistanceKm),
+		string(e.Purpose),
+		e.Note,
+		e.Driver,
+		strconv.Itoa(e.Corrects),
+		e.PrevHash,
+	}
+	sum := sha256.Sum256([]byte(strings.Join(fields, "\x1f")))
+
+	return hex.EncodeToString(sum[:])
+}
+
+type Gap struct {
+	After      int       `json:"after"`
+	Before     int       `json:"before,omitempty"`
+	At         time.Time `json:"at"`
+	FromKm     float64   `json:"fromKm"`
+	ToKm       float64   `json:"toKm"`
+	DistanceKm float64   `json:"distanceKm"`
+}
+
+type Classifier interface {
+	Classify(trip *connecteddrive.Trip) (Purpose, string)
+}
+
+type ClassifierFunc func(trip *connecteddrive.Trip) (Purpose, string)
+
+func (f ClassifierFunc) Classify(trip *connecteddrive.Trip) (Purpose, string) {
+	return f(trip)
+}
+
+// Logbook is an append-only, hash-chained driver's logbook for one vehicle. Entries are never changed;
+// corrections are recorded as additional entries referencing the corrected one.
+type Logbook struct {
+	Vin        string
+	Driver     string
+	entries    []Entry
+	trips      map[string]bool
+	classifier Classifier
+	mutex      *sync.Mutex
+}
+
+func New(vin string, driver string, classifier Classifier) *Logbook {
+	if classifier == nil {
+		classifier = ClassifierFunc(func(_ *connecteddrive.Trip) (Purpose, string) {
+			return PurposeBusiness, ""
+		})
+	}
+
+	return &Logbook{
+		Vin:        vin,
+		Driver:     driver,
+		trips:      make(map[string]bool),
+		classifier: classifier,
+		mutex:      &sync.Mutex{},
+	}
+}
+
+// Load restores a logbook from previously exported entries after verifying their hash chain.
+func Load(vin string, driver string, classifier Classifier, entries []Entry) (*Logbook, error) {
+	l := New(vin, driver, classifier)
+	l.entries = append(l.entries, entries...)
+	for _, e := range entries {
+		if e.Vin != vin {
+			return nil, fmt.Errorf("logbook verification error: entry %d belongs to vehicle %s", e.Sequence, e.Vin)
+		}
+		if e.TripId != "" {
+			l.trips[e.TripId] = true
+		}
+	}
+
+	err := l.verify()
+	if err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+func (l *Logbook) Entries() []Entry {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return append([]Entry(nil), l.entries...)
+}
+
+// AddTrips appends trips not yet recorded, oldest first. A missing odometer reading is derived from the other
+// reading and the distance of the trip; it is never taken from the previous entry, so that Gaps reports it.
+func (l *Logbook) AddTrips(trips connecteddrive.Trips) []Entry {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	sorted := append(connecteddrive.Trips(nil), trips...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].StartTime.Before(sorted[j].StartTime)
+	})
+
+	var added []Entry
+	for _, t := range sorted {
+		if t == nil || (t.Id != "" && l.trips[t.Id]) {
+			continue
+		}
+
+		purpose, note := l.classifier.Classify(t)
+		distance := t.Distance.Km()
+		start := t.StartMileage.Km()
+		end := t.EndMileage.Km()
+		if start == 0 && end != 0 {
+			start = end - distance
+		}
+		if end == 0 && start != 0 {
+			end = start + distance
+		}
+		if distance == 0 {
+			distance = end - start
+		}
+
+		e := l.append(Entry{
+			Kind:            EntryKindTrip,
+			Vin:             l.Vin,
+			TripId:          t.Id,
+			StartTime:       t.StartTime,
+			EndTime:         t.EndTime,
+			StartAddress:    t.StartLocation.Formatted,
+			EndAddress:      t.EndLocation.Formatted,
+			OdometerStartKm: roundKm(start),
+			OdometerEndKm:   roundKm(end),
+			DistanceKm:      roundKm(distance),
+			Purpose:         purpose,
+			Note:            note,
+			Driver:          l.Driver,
+		})
+		if t.Id != "" {
+			l.trips[t.Id] = true
+		}
+		added = append(added, e)
+	}
+
+	return added
+}
+
+// Correct records a new purpose and note for a trip entry. The original entry stays in the chain.
+func (l *Logbook) Correct(sequence int, purpose Purpose, note string) (Entry, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if sequence < 1 || sequence > len(l.entries) || l.entries[sequence-1].Kind != EntryKindTrip {
+		return Entry{}, fmt.Errorf("Correct error: no trip entry with sequence %d", sequence)
+	}
+
+	e := l.entries[sequence-1]
+	e.Kind = EntryKindCorrection
+	e.Purpose = purpose
+	e.Note = note
+	e.Corrects = sequence
+
+	return l.append(e), nil
+}
+
+func (l *Logbook) append(e Entry) Entry {
+	e.Sequence = len(l.entries) + 1
+	e.RecordedAt = time.Now().UTC()
+	if len(l.entries) > 0 {
+		e.PrevHash = l.entries[len(l.entries)-1].Hash
+	}
+	e.Hash = e.computeHash()
+	l.entries = append(l.entries, e)
+
+	return e
+}
+
+func (l *Logbook) lastTrip() *Entry {
+	for i := len(l.entries) - 1; i >= 0; i-- {
+		if l.entries[i].Kind == EntryKindTrip {
+			return &l.entries[i]
+		}
+	}
+
+	return nil
+}
+
+// Checkpoint pins the logbook at one entry. The hash chain alone can't reveal entries removed from its end
+// or a rewritten tail; keep a checkpoint outside the logbook and pass it to VerifyCheckpoint to detect both.
+type Checkpoint struct {
+	Sequence int    `json:"sequence"`
+	Hash     string `json:"hash"`
+}
+
+// Head returns a checkpoint of the last entry, or a zero checkpoint for an empty logbook.
+func (l *Logbook) Head() Checkpoint {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if len(l.entries) == 0 {
+		return Checkpoint{}
+	}
+	last := l.entries[len(l.entries)-1]
+
+	return Checkpoint{Sequence: last.Sequence, Hash: last.Hash}
+}
+
+// Verify recomputes the hash chain and reports the first entry that was altered, reordered or removed from
+// the middle of the chain. Removing entries from the end or rewriting the whole tail is only detected by
+// VerifyCheckpoint.
+func (l *Logbook) Verify() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.verify()
+}
+
+// VerifyCheckpoint verifies the hash chain and that the entry pinned by the checkpoint is still part of it.
+func (l *Logbook) VerifyCheckpoint(c Checkpoint) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	err := l.verify()
+	if err != nil {
+		return err
+	}
+	if c.Sequence == 0 {
+		return nil
+	}
+	if c.Sequence > len(l.entries) {
+		return fmt.Errorf("logbook verification error: entries after %d were removed", len(l.entries))
+	}
+	if l.entries[c.Sequence-1].Hash != c.Hash {
+		return fmt.Errorf("logbook verification error: entry %d was rewritten", c.Sequence)
+	}
+
+	return nil
+}
+
+func (l *Logbook) verify() error {
+	prev := ""
+	for i, e := range l.entries {
+		if e.Sequence != i+1 {
+			return fmt.Errorf("logbook verification error: entry %d has sequence %d", i+1, e.Sequence)
+		}
+		if e.PrevHash != prev {
+			return fmt.Errorf("logbook verification error: entry %d does not follow entry %d", e.Sequence, i)
+		}
+		if e.computeHash() != e.Hash {
+			return fmt.Errorf("logbook verification error: entry %d was modified", e.Sequence)
+		}
+		prev = e.Hash
+	}
+
+	return nil
+}
+
+// Gaps reports odometer discontinuities between consecutive trips larger than toleranceKm.
+func (l *Logbook) Gaps(toleranceKm float64) []Gap {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	var gaps []Gap
+	var prev *Entry
+	for i := range l.entries {
+		e := &l.entries[i]
+		if e.Kind != EntryKindTrip {
+			continue
+		}
+
+		if prev != nil && math.Abs(e.OdometerStartKm-prev.OdometerEndKm) > toleranceKm {
+			gaps = append(gaps, Gap{
+				After:      prev.Sequence,
+				Before:     e.Sequence,
+				At:         prev.EndTime,
+				FromKm:     prev.OdometerEndKm,
+				ToKm:       e.OdometerStartKm,
+				DistanceKm: roundKm(e.OdometerStartKm - prev.OdometerEndKm),
+			})
+		}
+		prev = e
+	}
+
+	return gaps
+}
+
+// GapToVehicle compares the last recorded odometer reading with the current mileage of the vehicle.
+func (l *Logbook) GapToVehicle(v *connecteddrive.Vehicle, toleranceKm float64) *Gap {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	last := l.lastTrip()
+	if last == nil {
+		return nil
+	}
+
+	current := v.Status.CurrentMileage.Distance().Km()
+	if math.Abs(current-last.OdometerEndKm) <= toleranceKm {
+		return nil
+	}
+
+	return &Gap{
+		After:      last.Sequence,
+		At:         v.Status.LastUpdatedAt,
+		FromKm:     last.OdometerEndKm,
+		ToKm:       roundKm(current),
+		DistanceKm: roundKm(current - last.OdometerEndKm),
+	}
+}
+
+var rowHeader = []string{
+	"sequence",
+	"kind",
+	"recorded_at",
+	"vin",
+	"driver",
+	"trip_id",
+	"start_time",
+	"end_time",
+	"start_address",
+	"end_address",
+	"odometer_start_km",
+	"odometer_end_km",
+	"distance_km",
+	"purpose",
+	"note",
+	"corrects",
+	"prev_hash",
+	"hash",
+}
+
+// Rows returns the logbook as a header and text rows, suitable for CSV or a PDF table. Values are written
+// exactly as they are hashed, so an export can be verified with ReadCSV.
+func (l *Logbook) Rows() [][]string {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	rows := [][]string{append([]string(nil), rowHeader...)}
+	for _, e := range l.entries {
+		corrects := ""
+		if e.Corrects > 0 {
+			corrects = strconv.Itoa(e.Corrects)
+		}
+
+		rows = append(rows, []string{
+			strconv.Itoa(e.Sequence),
+			string(e.Kind),
+			formatTime(e.RecordedAt),
+			e.Vin,
+			e.Driver,
+			e.TripId,
+			formatTime(e.StartTime),
+			formatTime(e.EndTime),
+			e.StartAddress,
+			e.EndAddress,
+			formatKm(e.OdometerStartKm),
+			formatKm(e.OdometerEndKm),
+			formatKm(e.DistanceKm),
+			string(e.Purpose),
+			e.Note,
+			corrects,
+			e.PrevHash,
+			e.Hash,
+		})
+	}
+
+	return rows
+}
+
+func (l *Logbook) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	err := cw.WriteAll(l.Rows())
+	if err != nil {
+		return fmt.Errorf("WriteCSV error: %w", err)
+	}
+
+	return nil
+}
+
+// ReadCSV restores the logbook of the given vehicle written by WriteCSV and verifies its hash chain. A file
+// with only the header is an empty logbook.
+func ReadCSV(r io.Reader, vin string, driver string, classifier Classifier) (*Logbook, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("ReadCSV error: %w", err)
+	}
+	if len(records) == 0 || strings.Join(records[0], ",") != strings.Join(rowHeader, ",") {
+		return nil, fmt.Errorf("ReadCSV error: missing or unexpected header")
+	}
+
+	entries := make([]Entry, 0, len(records)-1)
+	for i, record := range records[1:] {
+		e, err := parseRow(record)
+		if err != nil {
+			return nil, fmt.Errorf("ReadCSV error: row %d: %w", i+2, err)
+		}
+		entries = append(entries, e)
+	}
+
+	return Load(vin, driver, classifier, entries)
+}
+
+func parseRow(record []string) (Entry, error) {
+	e := Entry{
+		Kind:         EntryKind(record[1]),
+		Vin:          record[3],
+		Driver:       record[4],
+		TripId:       record[5],
+		StartAddress: record[8],
+		EndAddress:   record[9],
+		Purpose:      Purpose(record[13]),
+		Note:         record[14],
+		PrevHash:     record[16],
+		Hash:         record[17],
+	}
+
+	var err error
+	e.Sequence, err = strconv.Atoi(record[0])
+	if err == nil && record[15] != "" {
+		e.Corrects, err = strconv.Atoi(record[15])
+	}
+	for i, t := range []*time.Time{&e.RecordedAt, &e.StartTime, &e.EndTime} {
+		if err != nil {
+			break
+		}
+		*t, err = time.Parse(time.RFC3339Nano, record[[]int{2, 6, 7}[i]])
+	}
+	for i, km := range []*float64{&e.OdometerStartKm, &e.OdometerEndKm, &e.DistanceKm} {
+		if err != nil {
+			break
+		}
+		*km, err = strconv.ParseFloat(record[10+i], 64)
+	}
+
+	return e, err
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+func formatKm(km float64) string {
+	return strconv.FormatFloat(km, 'f', 1, 64)
+}
+
+func roundKm(km float64) float64 {
+	return math.Round(km*10) / 10
+}
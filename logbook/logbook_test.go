@@ -0,0 +1,174 @@
+package logbook
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	connecteddrive "github.com/sdrobov/connected-drive"
+)
+
+const testVin = "WBA00000000000001"
+
+func testTrips(n int) connecteddrive.Trips {
+	start := time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC)
+
+	var trips connecteddrive.Trips
+	for i := 0; i < n; i++ {
+		odometer := 1000 + float64(i)*20
+		trips = append(trips, &connecteddrive.Trip{
+			Id:           string(rune('a' + i)),
+			StartTime:    start.Add(time.Duration(i) * 24 * time.Hour),
+			EndTime:      start.Add(time.Duration(i)*24*time.Hour + 30*time.Minute),
+			StartMileage: connecteddrive.Distance{Value: odometer, Units: "KILOMETERS"},
+			EndMileage:   connecteddrive.Distance{Value: odometer + 20, Units: "KILOMETERS"},
+			Distance:     connecteddrive.Distance{Value: 20, Units: "KILOMETERS"},
+		})
+	}
+
+	return trips
+}
+
+func testLogbook(t *testing.T, trips int) *Logbook {
+	t.Helper()
+
+	l := New(testVin, "Jane Doe", nil)
+	l.AddTrips(testTrips(trips))
+	_, err := l.Correct(2, PurposePrivate, "weekend")
+	if err != nil {
+		t.Fatalf("Correct: %v", err)
+	}
+
+	return l
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(entries []Entry) []Entry
+	}{
+		{"modified", func(entries []Entry) []Entry {
+			entries[1].DistanceKm = 2
+
+			return entries
+		}},
+		{"removed", func(entries []Entry) []Entry {
+			return append(entries[:1], entries[2:]...)
+		}},
+		{"reordered", func(entries []Entry) []Entry {
+			entries[0], entries[1] = entries[1], entries[0]
+
+			return entries
+		}},
+		{"relabelled", func(entries []Entry) []Entry {
+			entries[2].Vin = "WBA00000000000002"
+
+			return entries
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := testLogbook(t, 3)
+			err := l.Verify()
+			if err != nil {
+				t.Fatalf("Verify before tampering: %v", err)
+			}
+
+			l.entries = tt.tamper(l.entries)
+			if l.Verify() == nil {
+				t.Error("Verify accepted a tampered logbook")
+			}
+		})
+	}
+}
+
+func TestVerifyCheckpoint(t *testing.T) {
+	l := testLogbook(t, 3)
+	head := l.Head()
+	if head.Sequence != 4 {
+		t.Fatalf("head at %d, want 4", head.Sequence)
+	}
+
+	l.AddTrips(testTrips(4))
+	err := l.VerifyCheckpoint(head)
+	if err != nil {
+		t.Errorf("VerifyCheckpoint after appending: %v", err)
+	}
+
+	truncated, err := Load(testVin, "Jane Doe", nil, l.Entries()[:3])
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if truncated.Verify() != nil {
+		t.Fatal("a truncated chain is expected to pass Verify")
+	}
+	if truncated.VerifyCheckpoint(head) == nil {
+		t.Error("VerifyCheckpoint accepted a truncated logbook")
+	}
+
+	rewritten := New(testVin, "Jane Doe", nil)
+	rewritten.AddTrips(testTrips(4))
+	if rewritten.VerifyCheckpoint(head) == nil {
+		t.Error("VerifyCheckpoint accepted a rewritten logbook")
+	}
+
+	if New(testVin, "", nil).VerifyCheckpoint(Checkpoint{}) != nil {
+		t.Error("VerifyCheckpoint rejected an empty logbook with a zero checkpoint")
+	}
+}
+
+func TestReadCSVRoundTrip(t *testing.T) {
+	for _, trips := range []int{0, 3} {
+		l := New(testVin, "Jane Doe", nil)
+		l.AddTrips(testTrips(trips))
+
+		var b bytes.Buffer
+		err := l.WriteCSV(&b)
+		if err != nil {
+			t.Fatalf("WriteCSV: %v", err)
+		}
+
+		read, err := ReadCSV(bytes.NewReader(b.Bytes()), testVin, "Jane Doe", nil)
+		if err != nil {
+			t.Fatalf("ReadCSV of %d trips: %v", trips, err)
+		}
+		if !reflect.DeepEqual(read.Entries(), l.Entries()) {
+			t.Errorf("ReadCSV of %d trips: got %+v, want %+v", trips, read.Entries(), l.Entries())
+		}
+		if read.Head() != l.Head() {
+			t.Errorf("ReadCSV of %d trips: head %+v, want %+v", trips, read.Head(), l.Head())
+		}
+
+		// trips already in the logbook are not added again
+		if added := read.AddTrips(testTrips(trips)); len(added) != 0 {
+			t.Errorf("ReadCSV of %d trips: re-added %d trips", trips, len(added))
+		}
+	}
+}
+
+func TestReadCSVRejectsTampering(t *testing.T) {
+	l := testLogbook(t, 3)
+	var b bytes.Buffer
+	err := l.WriteCSV(&b)
+	if err != nil {
+		t.Fatalf("WriteCSV: %v", err)
+	}
+
+	_, err = ReadCSV(strings.NewReader(strings.Replace(b.String(), ",PRIVATE,", ",BUSINESS,", 1)), testVin, "", nil)
+	if err == nil {
+		t.Error("ReadCSV accepted a modified entry")
+	}
+
+	_, err = ReadCSV(bytes.NewReader(b.Bytes()), "WBA00000000000002", "", nil)
+	if err == nil {
+		t.Error("ReadCSV accepted entries of another vehicle")
+	}
+
+	_, err = ReadCSV(strings.NewReader("sequence,kind\n"), testVin, "", nil)
+	if err == nil {
+		t.Error("ReadCSV accepted an unexpected header")
+	}
+}
@@ -0,0 +1,54 @@
+package connected_drive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+var ErrRevocationUnsupported = errors.New("token revocation is not supported")
+
+// Revoker is implemented by authenticators whose OAuth server can revoke tokens (RFC 7009).
+type Revoker interface {
+	Revoke(ctx context.Context, token *Token) error
+}
+
+// Logout ends the session: the refresh token is revoked at the OAuth server when the authenticator supports it,
+// then the tokens are dropped from memory and from the token store. revoked reports whether the server
+// confirmed the revocation. If revocation fails the session is kept so that Logout can be retried.
+func (c *Client) Logout(ctx context.Context) (revoked bool, err error) {
+	ctx, op := c.startOperation(ctx, "Logout")
+	defer func() { op.end(err) }()
+
+	c.authMutex.Lock()
+	defer c.authMutex.Unlock()
+
+	if c.auth == nil {
+		c.loadAuth()
+	}
+
+	if c.auth != nil && (c.auth.RefreshToken != "" || c.auth.AccessToken != "") {
+		if revoker, ok := c.authenticator.(Revoker); ok {
+			err = revoker.Revoke(ctx, c.auth)
+			switch {
+			case err == nil:
+				revoked = true
+			case errors.Is(err, ErrRevocationUnsupported):
+			default:
+				return false, fmt.Errorf("logout error: %w", err)
+			}
+		}
+	}
+
+	c.auth = nil
+	c.log(ctx, LogLevelInfo, "logged out", "revoked", revoked)
+
+	if c.authStore != nil {
+		err = c.authStore.Delete()
+		if err != nil {
+			return revoked, fmt.Errorf("logout error: can't delete stored tokens: %w", err)
+		}
+	}
+
+	return revoked, nil
+}
@@ -0,0 +1,208 @@
+package notify
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	connecteddrive "github.com/sdrobov/connected-drive"
+)
+
+const (
+	defaultNightStartHour   = 22
+	defaultNightEndHour     = 6
+	defaultLowFuelLiters    = 8
+	defaultLowFuelPercent   = 15
+	defaultServiceDueWithin = 14 * 24 * time.Hour
+)
+
+type RainFunc func(latitude float64, longitude float64, at time.Time) bool
+
+type DetectorConfig struct {
+	Location         *time.Location
+	NightStartHour   int
+	NightEndHour     int
+	LowFuelLiters    float64
+	LowFuelPercent   float64
+	ServiceDueWithin time.Duration
+	MinSeverity      connecteddrive.Severity
+	// IsRaining enables window-open-in-rain events. The library has no weather source of its own.
+	IsRaining RainFunc
+}
+
+func (c DetectorConfig) withDefaults() DetectorConfig {
+	if c.Location == nil {
+		c.Location = time.Local
+	}
+	if c.NightStartHour == 0 && c.NightEndHour == 0 {
+		c.NightStartHour, c.NightEndHour = defaultNightStartHour, defaultNightEndHour
+	}
+	if c.LowFuelLiters <= 0 {
+		c.LowFuelLiters = defaultLowFuelLiters
+	}
+	if c.LowFuelPercent <= 0 {
+		c.LowFuelPercent = defaultLowFuelPercent
+	}
+	if c.ServiceDueWithin <= 0 {
+		c.ServiceDueWithin = defaultServiceDueWithin
+	}
+	if c.MinSeverity == "" {
+		c.MinSeverity = connecteddrive.SeverityMedium
+	}
+
+	return c
+}
+
+// Detector derives events from vehicle snapshots. An event is raised once when its condition starts to
+// hold and again only after the condition cleared in between.
+type Detector struct {
+	config DetectorConfig
+	active map[string]bool
+	mutex  *sync.Mutex
+}
+
+func NewDetector(config DetectorConfig) *Detector {
+	return &Detector{
+		config: config.withDefaults(),
+		active: make(map[string]bool),
+		mutex:  &sync.Mutex{},
+	}
+}
+
+func (d *Detector) Detect(v *connecteddrive.Vehicle, now time.Time) []Event {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	conditions := d.conditions(v, now)
+
+	var events []Event
+	seen := make(map[string]bool)
+	for _, e := range conditions {
+		key := activeKey(e)
+		seen[key] = true
+		if d.active[key] {
+			continue
+		}
+
+		d.active[key] = true
+		events = append(events, e)
+	}
+
+	prefix := v.Vin + "|"
+	for key := range d.active {
+		if strings.HasPrefix(key, prefix) && !seen[key] {
+			delete(d.active, key)
+		}
+	}
+
+	return events
+}
+
+func (d *Detector) conditions(v *connecteddrive.Vehicle, now time.Time) []Event {
+	var events []Event
+	newEvent := func(eventType EventType, key string, severity string, message string) *Event {
+		e := NewEvent(eventType, v.Vin, key, now)
+		e.Model = v.Model
+		e.Severity = severity
+		e.Message = message
+		e.Data = map[string]interface{}{"key": key}
+		events = append(events, e)
+
+		return &events[len(events)-1]
+	}
+
+	if d.isNight(now) && !v.IsSecure() {
+		e := newEvent(EventUnlockedOvernight, "", string(connecteddrive.SeverityHigh), fmt.Sprintf(
+			"%s %s is not secured at night",
+			v.Model,
+			v.Vin,
+		))
+		e.Data["lockState"] = string(v.Status.DoorsGeneralState)
+		e.Data["openOpenings"] = v.OpenOpenings()
+	}
+
+	if d.config.IsRaining != nil {
+		var windows []string
+		for _, opening := range v.OpenOpenings() {
+			if strings.HasSuffix(opening, "Window") {
+				windows = append(windows, opening)
+			}
+		}
+
+		l := v.Properties.VehicleLocation.Coordinates
+		if len(windows) > 0 && d.config.IsRaining(l.Latitude, l.Longitude, now) {
+			e := newEvent(EventWindowOpenInRain, "", string(connecteddrive.SeverityHigh), fmt.Sprintf(
+				"%s %s has open windows while it is raining",
+				v.Model,
+				v.Vin,
+			))
+			e.Data["windows"] = windows
+		}
+	}
+
+	for _, w := range v.Warnings(d.config.MinSeverity) {
+		key := firstNonEmpty(w.Id, w.Code, w.Title)
+		e := newEvent(EventCheckControlWarning, key, string(w.Severity), w.Title)
+		e.Data["code"] = w.Code
+		e.Data["category"] = string(w.Category())
+		e.Data["description"] = w.Description
+	}
+
+	plan := v.ServicePlan(nil)
+	for _, item := range plan.Upcoming(d.config.ServiceDueWithin) {
+		e := newEvent(EventServiceDueSoon, item.Type, string(item.Criticalness.Severity()), fmt.Sprintf(
+			"%s is due on %s",
+			item.Title,
+			item.NextDueDate().Format("2006-01-02"),
+		))
+		e.Data["dueDate"] = item.NextDueDate()
+		if item.DueDistance != nil {
+			e.Data["dueDistance"] = *item.DueDistance
+		}
+	}
+
+	level := v.Properties.FuelLevel
+	low := false
+	if level.IsPercent() {
+		low = level.Units != "" && level.Value <= d.config.LowFuelPercent
+	} else if level.Units != "" {
+		low = level.Liters() <= d.config.LowFuelLiters
+	}
+	if low {
+		e := newEvent(EventLowFuel, "", string(connecteddrive.SeverityMedium), fmt.Sprintf(
+			"%s %s is low on fuel: %.0f %s",
+			v.Model,
+			v.Vin,
+			level.Value,
+			strings.ToLower(level.Units),
+		))
+		e.Data["fuelLevel"] = level
+		e.Data["range"] = v.Properties.CombustionRange.Distance
+	}
+
+	return events
+}
+
+func (d *Detector) isNight(now time.Time) bool {
+	hour := now.In(d.config.Location).Hour()
+	if d.config.NightStartHour > d.config.NightEndHour {
+		return hour >= d.config.NightStartHour || hour < d.config.NightEndHour
+	}
+
+	return hour >= d.config.NightStartHour && hour < d.config.NightEndHour
+}
+
+func activeKey(e Event) string {
+	return fmt.Sprintf("%s|%s|%v", e.Vin, e.Type, e.Data["key"])
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,65 @@
+package notify
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+type EventType string
+
+const (
+	EventUnlockedOvernight   EventType = "UNLOCKED_OVERNIGHT"
+	EventWindowOpenInRain    EventType = "WINDOW_OPEN_IN_RAIN"
+	EventCheckControlWarning EventType = "CHECK_CONTROL_WARNING"
+	EventServiceDueSoon      EventType = "SERVICE_DUE_SOON"
+	EventLowFuel             EventType = "LOW_FUEL"
+)
+
+type Event struct {
+	Id       string                 `json:"id"`
+	Type     EventType              `json:"type"`
+	Vin      string                 `json:"vin"`
+	Model    string                 `json:"model,omitempty"`
+	At       time.Time              `json:"at"`
+	Severity string                 `json:"severity"`
+	Message  string                 `json:"message"`
+	Data     map[string]interface{} `json:"data,omitempty"`
+}
+
+func NewEvent(eventType EventType, vin string, key string, at time.Time) Event {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%s|%s|%d", eventType, vin, key, at.UnixNano())))
+
+	return Event{
+		Id:   hex.EncodeToString(sum[:16]),
+		Type: eventType,
+		Vin:  vin,
+		At:   at,
+	}
+}
+
+type Notifier interface {
+	Notify(ctx context.Context, e Event) error
+}
+
+type NotifierFunc func(ctx context.Context, e Event) error
+
+func (f NotifierFunc) Notify(ctx context.Context, e Event) error {
+	return f(ctx, e)
+}
+
+type MultiNotifier []Notifier
+
+func (m MultiNotifier) Notify(ctx context.Context, e Event) error {
+	var firstErr error
+	for _, n := range m {
+		err := n.Notify(ctx, e)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
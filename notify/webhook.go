@@ -0,0 +1,299 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	SignatureHeader = "X-ConnectedDrive-Signature"
+	TimestampHeader = "X-ConnectedDrive-Timestamp"
+	EventHeader     = "X-ConnectedDrive-Event"
+
+	defaultMaxAttempts = 5
+	defaultBackoff     = 5 * time.Second
+	defaultTimeout     = 30 * time.Second
+	maxBackoff         = 10 * time.Minute
+)
+
+type Webhook struct {
+	Url    string      `json:"url"`
+	Secret string      `json:"secret"`
+	Events []EventType `json:"events,omitempty"`
+}
+
+func (w Webhook) accepts(eventType EventType) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+
+	for _, t := range w.Events {
+		if t == eventType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Sign returns the signature of a payload sent at the given unix timestamp: the hex HMAC-SHA256 of
+// "<timestamp>.<payload>" keyed with the webhook secret, prefixed with "sha256=".
+func Sign(secret string, timestamp int64, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+type delivery struct {
+	Webhook   Webhook   `json:"-"`
+	Url       string    `json:"url"`
+	Event     Event     `json:"event"`
+	Attempts  int       `json:"attempts"`
+	LastError string    `json:"lastError,omitempty"`
+	FailedAt  time.Time `json:"failedAt,omitempty"`
+	next      time.Time
+}
+
+// WebhookNotifier posts signed events to webhooks. Failed deliveries are retried with exponential backoff
+// by Run; deliveries that exhaust their attempts are appended to the dead-letter file as JSON lines.
+// Each attempt is cancelled after Timeout, so a hung endpoint can't block the queue.
+// OnError, if set, is called with the event when it can't be written to the dead-letter file.
+type WebhookNotifier struct {
+	webhooks       []Webhook
+	httpClient     *http.Client
+	deadLetterPath string
+	MaxAttempts    int
+	Backoff        time.Duration
+	Timeout        time.Duration
+	OnError        func(e Event, err error)
+	queue          []*delivery
+	wakeup         chan struct{}
+	mutex          *sync.Mutex
+}
+
+func NewWebhookNotifier(httpClient *http.Client, deadLetterPath string, webhooks ...Webhook) *WebhookNotifier {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: defaultTimeout}
+	}
+
+	return &WebhookNotifier{
+		webhooks:       webhooks,
+		httpClient:     httpClient,
+		deadLetterPath: deadLetterPath,
+		MaxAttempts:    defaultMaxAttempts,
+		Backoff:        defaultBackoff,
+		Timeout:        defaultTimeout,
+		wakeup:         make(chan struct{}, 1),
+		mutex:          &sync.Mutex{},
+	}
+}
+
+// Notify queues the event for every webhook subscribed to its type. Delivery happens in Run.
+func (n *WebhookNotifier) Notify(_ context.Context, e Event) error {
+	n.mutex.Lock()
+	for _, w := range n.webhooks {
+		if w.accepts(e.Type) {
+			n.queue = append(n.queue, &delivery{Webhook: w, Url: w.Url, Event: e, next: time.Now()})
+		}
+	}
+	n.mutex.Unlock()
+
+	select {
+	case n.wakeup <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+func (n *WebhookNotifier) Pending() int {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	return len(n.queue)
+}
+
+// Run delivers queued events until the context is done. Deliveries still pending then are dead-lettered.
+func (n *WebhookNotifier) Run(ctx context.Context) error {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		wait := n.deliverDue(ctx)
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+
+		select {
+		case <-ctx.Done():
+			return n.drain(ctx.Err())
+		case <-n.wakeup:
+		case <-timer.C:
+		}
+	}
+}
+
+func (n *WebhookNotifier) deliverDue(ctx context.Context) time.Duration {
+	n.mutex.Lock()
+	now := time.Now()
+	var due []*delivery
+	var pending []*delivery
+	for _, d := range n.queue {
+		if d.next.After(now) {
+			pending = append(pending, d)
+		} else {
+			due = append(due, d)
+		}
+	}
+	n.queue = pending
+	n.mutex.Unlock()
+
+	for _, d := range due {
+		err := n.send(ctx, d)
+		if err == nil {
+			continue
+		}
+
+		d.Attempts++
+		d.LastError = err.Error()
+		if d.Attempts >= n.MaxAttempts {
+			d.FailedAt = time.Now()
+			n.deadLetter(d)
+
+			continue
+		}
+
+		backoff := n.Backoff << (d.Attempts - 1)
+		if backoff > maxBackoff || backoff <= 0 {
+			backoff = maxBackoff
+		}
+		d.next = time.Now().Add(backoff)
+
+		n.mutex.Lock()
+		n.queue = append(n.queue, d)
+		n.mutex.Unlock()
+	}
+
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	wait := maxBackoff
+	for _, d := range n.queue {
+		if w := time.Until(d.next); w < wait {
+			wait = w
+		}
+	}
+	if wait < 0 {
+		wait = 0
+	}
+
+	return wait
+}
+
+func (n *WebhookNotifier) send(ctx context.Context, d *delivery) error {
+	payload, err := json.Marshal(d.Event)
+	if err != nil {
+		return fmt.Errorf("can't encode event: %w", err)
+	}
+
+	if n.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, n.Timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.Webhook.Url, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("can't create request: %w", err)
+	}
+
+	timestamp := time.Now().Unix()
+	req.Header = http.Header{
+		"Content-Type":  {"application/json"},
+		EventHeader:     {string(d.Event.Type)},
+		TimestampHeader: {strconv.FormatInt(timestamp, 10)},
+	}
+	if d.Webhook.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(d.Webhook.Secret, timestamp, payload))
+	}
+
+	resp, err := n.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("can't send request: %w", err)
+	}
+
+	defer func(body io.ReadCloser) {
+		_, _ = io.Copy(io.Discard, body)
+		_ = body.Close()
+	}(resp.Body)
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("webhook responded with %s", resp.Status)
+	}
+
+	return nil
+}
+
+func (n *WebhookNotifier) drain(err error) error {
+	n.mutex.Lock()
+	pending := n.queue
+	n.queue = nil
+	n.mutex.Unlock()
+
+	for _, d := range pending {
+		d.LastError = fmt.Sprintf("not delivered before shutdown: %v", err)
+		d.FailedAt = time.Now()
+		n.deadLetter(d)
+	}
+
+	return err
+}
+
+func (n *WebhookNotifier) deadLetter(d *delivery) {
+	err := n.writeDeadLetter(d)
+	if err != nil && n.OnError != nil {
+		n.OnError(d.Event, fmt.Errorf("can't write dead letter for %s: %w", d.Url, err))
+	}
+}
+
+func (n *WebhookNotifier) writeDeadLetter(d *delivery) error {
+	if n.deadLetterPath == "" {
+		return nil
+	}
+
+	line, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(n.deadLetterPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(append(line, '\n'))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
@@ -0,0 +1,185 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testEvent() Event {
+	return Event{Type: EventLowFuel, Vin: "WBA00000000000001", Message: "low on fuel"}
+}
+
+// runUntil runs the notifier until done reports true or a second has passed.
+func runUntil(t *testing.T, n *WebhookNotifier, done func() bool) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	finished := make(chan struct{})
+	go func() {
+		_ = n.Run(ctx)
+		close(finished)
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for !done() && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	<-finished
+}
+
+func TestWebhookSignsPayload(t *testing.T) {
+	type request struct {
+		header http.Header
+		body   []byte
+	}
+	received := make(chan request, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- request{r.Header, body}
+	}))
+	defer server.Close()
+
+	n := NewWebhookNotifier(server.Client(), "", Webhook{Url: server.URL, Secret: "s3cret"})
+	_ = n.Notify(context.Background(), testEvent())
+	runUntil(t, n, func() bool { return len(received) > 0 })
+
+	select {
+	case r := <-received:
+		timestamp, err := strconv.ParseInt(r.header.Get(TimestampHeader), 10, 64)
+		if err != nil {
+			t.Fatalf("bad timestamp header: %v", err)
+		}
+		if got, want := r.header.Get(SignatureHeader), Sign("s3cret", timestamp, r.body); got != want {
+			t.Errorf("signature %q, want %q", got, want)
+		}
+		if Sign("other", timestamp, r.body) == r.header.Get(SignatureHeader) {
+			t.Error("signature doesn't depend on the secret")
+		}
+		if got := r.header.Get(EventHeader); got != string(EventLowFuel) {
+			t.Errorf("event header %q", got)
+		}
+	default:
+		t.Fatal("webhook was not called")
+	}
+}
+
+func TestWebhookDeadLetters(t *testing.T) {
+	var mutex sync.Mutex
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		calls++
+		mutex.Unlock()
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "dead.jsonl")
+	n := NewWebhookNotifier(server.Client(), path, Webhook{Url: server.URL})
+	n.MaxAttempts = 2
+	n.Backoff = time.Millisecond
+	_ = n.Notify(context.Background(), testEvent())
+	runUntil(t, n, func() bool {
+		_, err := os.Stat(path)
+
+		return err == nil
+	})
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("dead-letter file: %v", err)
+	}
+	defer f.Close()
+
+	var lines []delivery
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var d delivery
+		err := json.Unmarshal(scanner.Bytes(), &d)
+		if err != nil {
+			t.Fatalf("dead letter %q: %v", scanner.Text(), err)
+		}
+		lines = append(lines, d)
+	}
+
+	if len(lines) != 1 || lines[0].Attempts != 2 || lines[0].Event.Vin != testEvent().Vin || lines[0].LastError == "" {
+		t.Errorf("got dead letters %+v", lines)
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if calls != 2 {
+		t.Errorf("webhook called %d times, want 2", calls)
+	}
+}
+
+func TestWebhookReportsDeadLetterErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "missing", "dead.jsonl")
+	n := NewWebhookNotifier(server.Client(), path, Webhook{Url: server.URL})
+	n.MaxAttempts = 1
+
+	reported := make(chan Event, 1)
+	n.OnError = func(e Event, err error) {
+		reported <- e
+	}
+	_ = n.Notify(context.Background(), testEvent())
+	runUntil(t, n, func() bool { return len(reported) > 0 })
+
+	select {
+	case e := <-reported:
+		if e.Vin != testEvent().Vin {
+			t.Errorf("reported event %+v", e)
+		}
+	default:
+		t.Fatal("dead-letter write error was not reported")
+	}
+}
+
+func TestWebhookTimesOutHungEndpoint(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	path := filepath.Join(t.TempDir(), "dead.jsonl")
+	n := NewWebhookNotifier(server.Client(), path, Webhook{Url: server.URL})
+	n.MaxAttempts = 1
+	n.Timeout = 20 * time.Millisecond
+	_ = n.Notify(context.Background(), testEvent())
+	runUntil(t, n, func() bool {
+		_, err := os.Stat(path)
+
+		return err == nil
+	})
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("dead-letter file: %v", err)
+	}
+	var d delivery
+	err = json.Unmarshal(b, &d)
+	if err != nil || !strings.Contains(d.LastError, "deadline exceeded") || d.Attempts != 1 {
+		t.Errorf("got dead letter %s (%v)", b, err)
+	}
+}
@@ -0,0 +1,86 @@
+package connected_drive
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"net/url"
+)
+
+const (
+	pkceMethod         = "S256"
+	pkceVerifierLength = 86
+	pkceStateLength    = 22
+	pkceNonceLength    = 22
+	unreservedChars    = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ-._~"
+)
+
+// pkce holds the per-login secrets of the authorization code flow (RFC 7636).
+type pkce struct {
+	verifier  string
+	challenge string
+	state     string
+	nonce     string
+}
+
+func newPkce() (*pkce, error) {
+	verifier, err := randomString(pkceVerifierLength)
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := randomString(pkceStateLength)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce, err := randomString(pkceNonceLength)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+
+	return &pkce{
+		verifier:  verifier,
+		challenge: base64.RawURLEncoding.EncodeToString(sum[:]),
+		state:     state,
+		nonce:     nonce,
+	}, nil
+}
+
+// validateState checks that the authorization redirect carries the state sent with the login.
+func (p *pkce) validateState(query url.Values) error {
+	state := query.Get("state")
+	if subtle.ConstantTimeCompare([]byte(state), []byte(p.state)) != 1 {
+		return fmt.Errorf("state mismatch in redirect")
+	}
+
+	return nil
+}
+
+func (p *pkce) validateNonce(nonce string) error {
+	if subtle.ConstantTimeCompare([]byte(nonce), []byte(p.nonce)) != 1 {
+		return fmt.Errorf("id token nonce mismatch")
+	}
+
+	return nil
+}
+
+// randomString returns a cryptographically random string of URL-unreserved characters.
+func randomString(length int) (string, error) {
+	max := big.NewInt(int64(len(unreservedChars)))
+	b := make([]byte, length)
+	for i := range b {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", fmt.Errorf("can't read random data: %w", err)
+		}
+		b[i] = unreservedChars[n.Int64()]
+	}
+
+	return string(b), nil
+}
@@ -0,0 +1,99 @@
+package connected_drive
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+const profileRequestUrl = "https://cocoapi.bmwgroup.com/eadrax-ucs/v1/presentation/profile"
+
+type Profile struct {
+	Gcid       string `json:"gcid"`
+	Email      string `json:"email"`
+	Salutation string `json:"salutation"`
+	FirstName  string `json:"firstName"`
+	LastName   string `json:"lastName"`
+	Phone      string `json:"phone"`
+	Locale     string `json:"locale"`
+	Country    string `json:"country"`
+	Address    struct {
+		Street     string `json:"street"`
+		PostalCode string `json:"postalCode"`
+		City       string `json:"city"`
+		Country    string `json:"country"`
+	} `json:"address"`
+}
+
+// WithIdTokenVerifier makes Account verify the ID token signature against the issuer's published keys.
+func WithIdTokenVerifier(verifier *IdTokenVerifier) ClientOption {
+	return func(c *Client) {
+		c.idTokenVerifier = verifier
+	}
+}
+
+// Account returns the account the client is logged in with, taken from the claims of the ID token.
+func (c *Client) Account(ctx context.Context) (account *Account, err error) {
+	ctx, op := c.startOperation(ctx, "Account")
+	defer func() { op.end(err) }()
+
+	err = c.refreshAuth(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error refreshing auth while reading account: %w", err)
+	}
+
+	if c.auth.IdToken == "" {
+		return nil, ErrNoIdToken
+	}
+
+	var claims *IdTokenClaims
+	if c.idTokenVerifier != nil {
+		// the ID token is kept across refreshes when the server doesn't issue a new one, so it identifies the
+		// session even after its expiry
+		claims, err = c.idTokenVerifier.verify(ctx, c.auth.IdToken, "", false)
+	} else {
+		claims, err = ParseIdToken(c.auth.IdToken)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading id token: %w", err)
+	}
+
+	return claims.Account(), nil
+}
+
+func (c *Client) GetProfile(ctx context.Context) (profile *Profile, err error) {
+	ctx, op := c.startOperation(ctx, "GetProfile")
+	defer func() { op.end(err) }()
+
+	err = c.refreshAuth(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error refreshing auth while fetching profile: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, profileRequestUrl, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating profile request: %w", err)
+	}
+
+	req.Header = c.apiHeader()
+
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching profile: %w", err)
+	}
+
+	defer func(body io.ReadCloser) {
+		_ = body.Close()
+	}(resp.Body)
+
+	profile = new(Profile)
+	d := json.NewDecoder(resp.Body)
+	err = d.Decode(profile)
+	if err != nil || resp.StatusCode >= http.StatusBadRequest {
+		return nil, fmt.Errorf("error decoding profile: %w, %v", err, resp)
+	}
+
+	return profile, nil
+}
@@ -0,0 +1,191 @@
+package connected_drive
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type RecallStatus string
+
+const (
+	RecallStatusOpen       RecallStatus = "OPEN"
+	RecallStatusInProgress RecallStatus = "IN_PROGRESS"
+	RecallStatusCompleted  RecallStatus = "COMPLETED"
+	RecallStatusClosed     RecallStatus = "CLOSED"
+)
+
+var recallStatuses = []string{
+	string(RecallStatusOpen),
+	string(RecallStatusInProgress),
+	string(RecallStatusCompleted),
+	string(RecallStatusClosed),
+}
+
+func (s *RecallStatus) UnmarshalJSON(b []byte) error {
+	*s = RecallStatus(unmarshalEnum(b, recallStatuses))
+
+	return nil
+}
+
+func (s RecallStatus) IsKnown() bool {
+	return isKnownEnum(string(s), recallStatuses)
+}
+
+// IsOpen reports whether the recall still needs action. Recalls without a known status are treated as open.
+func (s RecallStatus) IsOpen() bool {
+	return s != RecallStatusCompleted && s != RecallStatusClosed
+}
+
+type RecallMessage struct {
+	Id          string       `json:"id"`
+	Title       string       `json:"title"`
+	Description string       `json:"description"`
+	Date        time.Time    `json:"date"`
+	RawDate     string       `json:"rawDate,omitempty"`
+	Status      RecallStatus `json:"status"`
+	ExternalUrl string       `json:"externalUrl,omitempty"`
+}
+
+// UnmarshalJSON never fails on unexpected field types or date formats, so that a single odd recall can't
+// break decoding of the whole vehicles list. Dates that can't be parsed are kept in RawDate.
+func (m *RecallMessage) UnmarshalJSON(b []byte) error {
+	var raw struct {
+		Id              json.RawMessage `json:"id"`
+		RecallId        json.RawMessage `json:"recallId"`
+		CampaignNumber  json.RawMessage `json:"campaignNumber"`
+		Title           json.RawMessage `json:"title"`
+		Name            json.RawMessage `json:"name"`
+		Description     json.RawMessage `json:"description"`
+		LongDescription json.RawMessage `json:"longDescription"`
+		Date            json.RawMessage `json:"date"`
+		DateTime        json.RawMessage `json:"dateTime"`
+		Status          json.RawMessage `json:"status"`
+		State           json.RawMessage `json:"state"`
+		ExternalUrl     RecallUrl       `json:"externalUrl"`
+		Url             RecallUrl       `json:"url"`
+	}
+	err := json.Unmarshal(b, &raw)
+	if err != nil {
+		*m = RecallMessage{Title: rawString(b)}
+
+		return nil
+	}
+
+	rawDate := firstNonEmpty(rawString(raw.Date), rawString(raw.DateTime))
+	date, err := parseRecallDate(rawDate)
+	if err == nil {
+		rawDate = ""
+	}
+
+	var status RecallStatus
+	for _, s := range []json.RawMessage{raw.Status, raw.State} {
+		if status == "" && len(s) > 0 {
+			_ = json.Unmarshal(s, &status)
+		}
+	}
+
+	*m = RecallMessage{
+		Id:          firstNonEmpty(rawString(raw.Id), rawString(raw.RecallId), rawString(raw.CampaignNumber)),
+		Title:       firstNonEmpty(rawString(raw.Title), rawString(raw.Name)),
+		Description: firstNonEmpty(rawString(raw.Description), rawString(raw.LongDescription)),
+		Date:        date,
+		RawDate:     rawDate,
+		Status:      status,
+		ExternalUrl: firstNonEmpty(string(raw.ExternalUrl), string(raw.Url)),
+	}
+
+	return nil
+}
+
+// RecallMessages ignores a recall list that is not an array instead of failing the vehicle.
+type RecallMessages []RecallMessage
+
+func (ms *RecallMessages) UnmarshalJSON(b []byte) error {
+	var messages []RecallMessage
+	if json.Unmarshal(b, &messages) != nil {
+		messages = nil
+	}
+	*ms = messages
+
+	return nil
+}
+
+// RecallUrl accepts a link sent as a string, as null or as an object with a url, href or link field.
+type RecallUrl string
+
+func (u *RecallUrl) UnmarshalJSON(b []byte) error {
+	var s string
+	if json.Unmarshal(b, &s) == nil {
+		*u = RecallUrl(s)
+
+		return nil
+	}
+
+	var link struct {
+		Url  string `json:"url"`
+		Href string `json:"href"`
+		Link string `json:"link"`
+	}
+	_ = json.Unmarshal(b, &link)
+	*u = RecallUrl(firstNonEmpty(link.Url, link.Href, link.Link))
+
+	return nil
+}
+
+func parseRecallDate(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, nil
+	}
+
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02"} {
+		t, err := time.Parse(layout, s)
+		if err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("can't parse recall date %q", s)
+}
+
+// Recalls returns the recall messages of the vehicle, falling back to the vehicle-wide external URL.
+func (v *Vehicle) Recalls() []RecallMessage {
+	recalls := make([]RecallMessage, 0, len(v.Status.RecallMessages))
+	for _, r := range v.Status.RecallMessages {
+		if r.ExternalUrl == "" {
+			r.ExternalUrl = string(v.Status.RecallExternalUrl)
+		}
+		recalls = append(recalls, r)
+	}
+
+	return recalls
+}
+
+func (v *Vehicle) OpenRecalls() []RecallMessage {
+	var open []RecallMessage
+	for _, r := range v.Recalls() {
+		if r.Status.IsOpen() {
+			open = append(open, r)
+		}
+	}
+
+	return open
+}
+
+// OpenRecalls returns the open recalls keyed by VIN. Vehicles without open recalls are omitted.
+func (vs Vehicles) OpenRecalls() map[string][]RecallMessage {
+	recalls := make(map[string][]RecallMessage)
+	for _, v := range vs {
+		if v == nil {
+			continue
+		}
+
+		if open := v.OpenRecalls(); len(open) > 0 {
+			recalls[v.Vin] = open
+		}
+	}
+
+	return recalls
+}
@@ -0,0 +1,267 @@
+package replay
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"unicode/utf8"
+)
+
+// vinHeader carries the VIN of vehicle specific requests, it is part of the match key.
+const vinHeader = "bmw-vin"
+
+var ErrNoInteraction = errors.New("no recorded interaction matches the request")
+
+type Mode int
+
+const (
+	// ModeReplay answers requests from the fixture file without touching the network.
+	ModeReplay Mode = iota
+	// ModeRecord sends requests to the network and records the scrubbed interactions.
+	ModeRecord
+)
+
+type Request struct {
+	Method       string      `json:"method"`
+	Url          string      `json:"url"`
+	Header       http.Header `json:"header,omitempty"`
+	Body         string      `json:"body,omitempty"`
+	BodyEncoding string      `json:"bodyEncoding,omitempty"`
+}
+
+type Response struct {
+	StatusCode   int         `json:"statusCode"`
+	Header       http.Header `json:"header,omitempty"`
+	Body         string      `json:"body,omitempty"`
+	BodyEncoding string      `json:"bodyEncoding,omitempty"`
+}
+
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+type Fixture struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Transport is an http.RoundTripper recording ConnectedDrive interactions into a fixture file or replaying them.
+// Set it as the Transport of the http.Client passed to connecteddrive.NewClient.
+//
+// Requests are matched on method, URL path and the (scrubbed) bmw-vin header; the query is ignored since it
+// carries timestamps. Interactions
+// matching the same request are replayed in recorded order, the last one repeats once all were used.
+//
+// Logins can't be replayed: PKCE parameters and state are random per login and scrubbed from the fixture.
+// Give the client a token store with a valid access token when replaying, and request vehicles by their fake
+// VINs; real VINs match no interaction.
+type Transport struct {
+	path      string
+	mode      Mode
+	transport http.RoundTripper
+	scrubber  *Scrubber
+	fixture   *Fixture
+	used      map[int]bool
+	mutex     *sync.Mutex
+}
+
+// New opens the fixture at path. In ModeReplay the file must exist; in ModeRecord it is written by Save.
+// transport is used to send requests when recording, http.DefaultTransport if nil.
+func New(path string, mode Mode, transport http.RoundTripper) (*Transport, error) {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	t := &Transport{
+		path:      path,
+		mode:      mode,
+		transport: transport,
+		scrubber:  NewScrubber(),
+		fixture:   &Fixture{},
+		used:      make(map[int]bool),
+		mutex:     &sync.Mutex{},
+	}
+
+	if mode == ModeReplay {
+		t.scrubber.replaying = true
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("can't read fixture: %w", err)
+		}
+
+		err = json.Unmarshal(data, t.fixture)
+		if err != nil {
+			return nil, fmt.Errorf("can't decode fixture %s: %w", path, err)
+		}
+	}
+
+	return t, nil
+}
+
+// Scrubber returns the scrubber applied to recorded interactions and to requests before they are matched.
+// It can be configured before the first request.
+func (t *Transport) Scrubber() *Scrubber {
+	return t.scrubber
+}
+
+func (t *Transport) Client() *http.Client {
+	return &http.Client{Transport: t}
+}
+
+func (t *Transport) Interactions() []Interaction {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return append([]Interaction(nil), t.fixture.Interactions...)
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	request, err := newRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if t.mode == ModeReplay {
+		t.scrubber.scrubRequest(&request)
+
+		return t.replay(req, request)
+	}
+
+	return t.record(req, request)
+}
+
+func (t *Transport) record(req *http.Request, request Request) (*http.Response, error) {
+	resp, err := t.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	interaction := Interaction{
+		Request: request,
+		Response: Response{
+			StatusCode: resp.StatusCode,
+			Header:     resp.Header.Clone(),
+		},
+	}
+	interaction.Response.Body, interaction.Response.BodyEncoding = encodeBody(body)
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.scrubber.scrub(&interaction)
+	t.fixture.Interactions = append(t.fixture.Interactions, interaction)
+
+	return resp, nil
+}
+
+func (t *Transport) replay(req *http.Request, request Request) (*http.Response, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	last := -1
+	for i, interaction := range t.fixture.Interactions {
+		if !matches(interaction.Request, request) {
+			continue
+		}
+
+		last = i
+		if !t.used[i] {
+			break
+		}
+	}
+	if last < 0 {
+		return nil, fmt.Errorf("%w: %s %s", ErrNoInteraction, request.Method, request.Url)
+	}
+	t.used[last] = true
+
+	recorded := t.fixture.Interactions[last].Response
+	body, err := decodeBody(recorded.Body, recorded.BodyEncoding)
+	if err != nil {
+		return nil, fmt.Errorf("can't decode recorded body: %w", err)
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", recorded.StatusCode, http.StatusText(recorded.StatusCode)),
+		StatusCode:    recorded.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        recorded.Header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// Save writes the recorded interactions to the fixture file.
+func (t *Transport) Save() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.mode != ModeRecord {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(t.fixture, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(t.path, data, 0o644)
+}
+
+func newRequest(req *http.Request) (Request, error) {
+	request := Request{
+		Method: req.Method,
+		Url:    req.URL.String(),
+		Header: req.Header.Clone(),
+	}
+
+	if req.Body != nil && req.Body != http.NoBody {
+		body, err := io.ReadAll(req.Body)
+		_ = req.Body.Close()
+		if err != nil {
+			return request, fmt.Errorf("can't read request body: %w", err)
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		request.Body, request.BodyEncoding = encodeBody(body)
+	}
+
+	return request, nil
+}
+
+func matches(recorded Request, request Request) bool {
+	return recorded.Method == request.Method &&
+		urlPath(recorded.Url) == urlPath(request.Url) &&
+		recorded.Header.Get(vinHeader) == request.Header.Get(vinHeader)
+}
+
+func encodeBody(body []byte) (string, string) {
+	if utf8.Valid(body) {
+		return string(body), ""
+	}
+
+	return base64.StdEncoding.EncodeToString(body), "base64"
+}
+
+func decodeBody(body string, encoding string) ([]byte, error) {
+	if encoding == "base64" {
+		return base64.StdEncoding.DecodeString(body)
+	}
+
+	return []byte(body), nil
+}
@@ -0,0 +1,109 @@
+package rules
+
+import (
+	"testing"
+)
+
+func TestExpressionPrecedence(t *testing.T) {
+	tests := []struct {
+		expr string
+		want interface{}
+	}{
+		{"1 + 2 * 3", float64(7)},
+		{"(1 + 2) * 3", float64(9)},
+		{"10 - 4 - 3", float64(3)},
+		{"12 / 3 / 2", float64(2)},
+		{"7 % 4 * 2", float64(6)},
+		{"-2 * 3", float64(-6)},
+		{"1 + 2 > 2", true},
+		{"(1 < 2) == true", true},
+		{"true || false && false", true},
+		{"(true || false) && false", false},
+		{"!false && false", false},
+		{"!(false && false)", true},
+		{"'a' + 'b' == 'ab'", true},
+		{"len('abc') * 2", float64(6)},
+		{"abs(-3) + 1", float64(4)},
+	}
+
+	for _, tt := range tests {
+		e, err := Compile(tt.expr)
+		if err != nil {
+			t.Fatalf("Compile(%q): %v", tt.expr, err)
+		}
+
+		got, err := e.Eval(nil)
+		if err != nil {
+			t.Fatalf("Eval(%q): %v", tt.expr, err)
+		}
+		if got != tt.want {
+			t.Errorf("Eval(%q) = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestExpressionMissingPaths(t *testing.T) {
+	env := map[string]interface{}{
+		"properties": map[string]interface{}{
+			"fuelLevel": map[string]interface{}{"value": float64(5)},
+			"openings":  []interface{}{"trunk"},
+		},
+	}
+
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{"properties.fuelLevel.value < 10", true},
+		{"properties.missing.value < 10", false},
+		{"properties.missing.value >= 10", false},
+		{"properties.missing == null", true},
+		{"properties.missing != null", false},
+		{"!properties.missing", true},
+		{"len(properties.missing) == 0", true},
+		{"contains(properties.missing, 'trunk')", false},
+		{"contains(properties.openings, 'trunk')", true},
+		{"properties.openings[0] == 'trunk'", true},
+		{"properties.openings[5] == null", true},
+		{"properties.fuelLevel.value.deeper == null", true},
+		{"lower(properties.missing) == ''", true},
+	}
+
+	for _, tt := range tests {
+		e, err := Compile(tt.expr)
+		if err != nil {
+			t.Fatalf("Compile(%q): %v", tt.expr, err)
+		}
+
+		got, err := e.EvalBool(env)
+		if err != nil {
+			t.Fatalf("EvalBool(%q): %v", tt.expr, err)
+		}
+		if got != tt.want {
+			t.Errorf("EvalBool(%q) = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestExpressionErrors(t *testing.T) {
+	compileErrors := []string{"1 +", "1 < 2 == true", "(1", "'open", "unknown(1)", "a.", "a[x]", "1 2"}
+	for _, expr := range compileErrors {
+		_, err := Compile(expr)
+		if err == nil {
+			t.Errorf("Compile(%q) succeeded, want error", expr)
+		}
+	}
+
+	evalErrors := []string{"1 / 0", "5 % 0", "'a' - 'b'", "'a' < 1", "-'a'", "abs('a')"}
+	for _, expr := range evalErrors {
+		e, err := Compile(expr)
+		if err != nil {
+			t.Fatalf("Compile(%q): %v", expr, err)
+		}
+
+		_, err = e.Eval(nil)
+		if err == nil {
+			t.Errorf("Eval(%q) succeeded, want error", expr)
+		}
+	}
+}
@@ -0,0 +1,327 @@
+package rules
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	connecteddrive "github.com/sdrobov/connected-drive"
+	"github.com/sdrobov/connected-drive/notify"
+)
+
+const EventRuleTriggered notify.EventType = "RULE_TRIGGERED"
+
+// Duration accepts Go duration strings like "15m" in JSON and YAML configs.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+
+	return nil
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+type Rule struct {
+	Name     string   `json:"name" yaml:"name"`
+	When     string   `json:"when" yaml:"when"`
+	Severity string   `json:"severity" yaml:"severity"`
+	Message  string   `json:"message" yaml:"message"`
+	For      Duration `json:"for" yaml:"for"`
+	Cooldown Duration `json:"cooldown" yaml:"cooldown"`
+	Notify   []string `json:"notify" yaml:"notify"`
+}
+
+type Config struct {
+	Timezone string `json:"timezone" yaml:"timezone"`
+	Rules    []Rule `json:"rules" yaml:"rules"`
+}
+
+// ParseConfig reads a JSON config. Pass a different unmarshal function, e.g. yaml.Unmarshal, for other formats.
+func ParseConfig(data []byte, unmarshal func([]byte, interface{}) error) (*Config, error) {
+	if unmarshal == nil {
+		unmarshal = json.Unmarshal
+	}
+
+	config := new(Config)
+	err := unmarshal(data, config)
+	if err != nil {
+		return nil, fmt.Errorf("can't parse rules config: %w", err)
+	}
+
+	return config, nil
+}
+
+type compiledRule struct {
+	Rule
+	when    *Expression
+	message *template.Template
+}
+
+type ruleState struct {
+	since     time.Time
+	firedAt   time.Time
+	triggered bool
+}
+
+// Engine evaluates rules against vehicle snapshots. A rule fires once its condition has held for the rule's
+// For duration. Without a cooldown it fires once per activation; with one it fires again while the condition
+// holds, at most once per cooldown.
+type Engine struct {
+	rules     []*compiledRule
+	location  *time.Location
+	notifiers map[string]notify.Notifier
+	states    map[string]*ruleState
+	mutex     *sync.Mutex
+}
+
+func NewEngine(config *Config, notifiers map[string]notify.Notifier) (*Engine, error) {
+	location := time.Local
+	if config.Timezone != "" {
+		var err error
+		location, err = time.LoadLocation(config.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timezone %q: %w", config.Timezone, err)
+		}
+	}
+
+	e := &Engine{
+		location:  location,
+		notifiers: notifiers,
+		states:    make(map[string]*ruleState),
+		mutex:     &sync.Mutex{},
+	}
+
+	names := make(map[string]bool)
+	for _, r := range config.Rules {
+		if r.Name == "" || names[r.Name] {
+			return nil, fmt.Errorf("rule names must be unique and not empty: %q", r.Name)
+		}
+		names[r.Name] = true
+
+		when, err := Compile(r.When)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %w", r.Name, err)
+		}
+
+		message := r.Message
+		if message == "" {
+			message = r.Name + " for {{.vin}}"
+		}
+		tmpl, err := template.New(r.Name).Option("missingkey=zero").Parse(message)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: invalid message: %w", r.Name, err)
+		}
+
+		for _, n := range r.Notify {
+			if _, ok := notifiers[n]; !ok {
+				return nil, fmt.Errorf("rule %s: unknown notifier %q", r.Name, n)
+			}
+		}
+
+		e.rules = append(e.rules, &compiledRule{Rule: r, when: when, message: tmpl})
+	}
+
+	return e, nil
+}
+
+// Environment returns the data rules are evaluated against: the vehicle as JSON, "time" with hour, minute,
+// weekday (0 is Sunday), date and unix, and "derived" with isSecure, openOpenings, warnings and openRecalls.
+func (e *Engine) Environment(v *connecteddrive.Vehicle, now time.Time) (map[string]interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	env := make(map[string]interface{})
+	err = json.Unmarshal(b, &env)
+	if err != nil {
+		return nil, err
+	}
+
+	local := now.In(e.location)
+	env["time"] = map[string]interface{}{
+		"hour":    float64(local.Hour()),
+		"minute":  float64(local.Minute()),
+		"weekday": float64(local.Weekday()),
+		"date":    local.Format("2006-01-02"),
+		"unix":    float64(local.Unix()),
+	}
+
+	openOpenings := make([]interface{}, 0)
+	for _, o := range v.OpenOpenings() {
+		openOpenings = append(openOpenings, o)
+	}
+	env["derived"] = map[string]interface{}{
+		"isSecure":     v.IsSecure(),
+		"openOpenings": openOpenings,
+		"warnings":     float64(len(v.Warnings(connecteddrive.SeverityLow))),
+		"openRecalls":  float64(len(v.OpenRecalls())),
+	}
+
+	return env, nil
+}
+
+// RuleErrors are the errors of single rules keyed by rule name. Rules without errors are still evaluated and
+// their events delivered.
+type RuleErrors map[string]error
+
+func (e RuleErrors) Error() string {
+	names := make([]string, 0, len(e))
+	for name := range e {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	messages := make([]string, 0, len(names))
+	for _, name := range names {
+		messages = append(messages, fmt.Sprintf("rule %s: %v", name, e[name]))
+	}
+
+	return fmt.Sprintf("errors in %d rule(s): %s", len(e), strings.Join(messages, "; "))
+}
+
+// Evaluate runs all rules against the snapshot, routes fired events to the rules' notifiers and returns them.
+// Failing rules don't prevent other rules from firing; their errors are returned as RuleErrors.
+// A rule counts as triggered once its event was handed to a notifier, so a rule whose notifiers all failed
+// fires again on the next evaluation.
+func (e *Engine) Evaluate(ctx context.Context, v *connecteddrive.Vehicle, now time.Time) ([]notify.Event, error) {
+	env, err := e.Environment(v, now)
+	if err != nil {
+		return nil, fmt.Errorf("can't build rule environment for %s: %w", v.Vin, err)
+	}
+
+	fired, ruleErrors := e.evaluate(v, env, now)
+
+	events := make([]notify.Event, 0, len(fired))
+	for _, f := range fired {
+		delivered := len(f.rule.Notify) == 0
+		for _, n := range f.rule.Notify {
+			err := e.notifiers[n].Notify(ctx, f.event)
+			if err != nil {
+				if _, ok := ruleErrors[f.rule.Name]; !ok {
+					ruleErrors[f.rule.Name] = fmt.Errorf("notifier %s failed for %s: %w", n, v.Vin, err)
+				}
+
+				continue
+			}
+			delivered = true
+		}
+
+		if delivered {
+			e.markTriggered(f, now)
+		}
+		events = append(events, f.event)
+	}
+
+	if len(ruleErrors) > 0 {
+		return events, ruleErrors
+	}
+
+	return events, nil
+}
+
+func (e *Engine) EvaluateAll(ctx context.Context, vehicles connecteddrive.Vehicles, now time.Time) ([]notify.Event, error) {
+	var events []notify.Event
+	var firstErr error
+	for _, v := range vehicles {
+		if v == nil {
+			continue
+		}
+
+		fired, err := e.Evaluate(ctx, v, now)
+		events = append(events, fired...)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return events, firstErr
+}
+
+type firedRule struct {
+	rule  *compiledRule
+	key   string
+	event notify.Event
+}
+
+func (e *Engine) evaluate(v *connecteddrive.Vehicle, env map[string]interface{}, now time.Time) ([]firedRule, RuleErrors) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	var fired []firedRule
+	ruleErrors := RuleErrors{}
+	for _, r := range e.rules {
+		ok, err := r.when.EvalBool(env)
+		if err != nil {
+			ruleErrors[r.Name] = fmt.Errorf("%s: %w", v.Vin, err)
+
+			continue
+		}
+
+		key := v.Vin + "|" + r.Name
+		state, exists := e.states[key]
+		if !ok {
+			delete(e.states, key)
+
+			continue
+		}
+		if !exists {
+			state = &ruleState{since: now}
+			e.states[key] = state
+		}
+
+		if now.Sub(state.since) < time.Duration(r.For) {
+			continue
+		}
+		if state.triggered && (r.Cooldown == 0 || now.Sub(state.firedAt) < time.Duration(r.Cooldown)) {
+			continue
+		}
+
+		var message bytes.Buffer
+		err = r.message.Execute(&message, env)
+		if err != nil {
+			ruleErrors[r.Name] = fmt.Errorf("%s: can't render message: %w", v.Vin, err)
+
+			continue
+		}
+
+		event := notify.NewEvent(EventRuleTriggered, v.Vin, r.Name, now)
+		event.Model = v.Model
+		event.Severity = r.Severity
+		event.Message = message.String()
+		event.Data = map[string]interface{}{
+			"rule":   r.Name,
+			"when":   r.When,
+			"since":  state.since,
+			"source": "rules",
+		}
+		fired = append(fired, firedRule{rule: r, key: key, event: event})
+	}
+
+	return fired, ruleErrors
+}
+
+func (e *Engine) markTriggered(f firedRule, now time.Time) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	state, ok := e.states[f.key]
+	if !ok {
+		return
+	}
+	state.triggered = true
+	state.firedAt = now
+}
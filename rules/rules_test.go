@@ -0,0 +1,160 @@
+package rules
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	connecteddrive "github.com/sdrobov/connected-drive"
+	"github.com/sdrobov/connected-drive/notify"
+)
+
+type recordingNotifier struct {
+	events []notify.Event
+	err    error
+}
+
+func (n *recordingNotifier) Notify(_ context.Context, event notify.Event) error {
+	if n.err != nil {
+		return n.err
+	}
+	n.events = append(n.events, event)
+
+	return nil
+}
+
+func newTestEngine(t *testing.T, rules ...Rule) (*Engine, *recordingNotifier) {
+	t.Helper()
+
+	for i := range rules {
+		rules[i].Notify = []string{"test"}
+	}
+	n := &recordingNotifier{}
+	e, err := NewEngine(&Config{Timezone: "UTC", Rules: rules}, map[string]notify.Notifier{"test": n})
+	if err != nil {
+		t.Fatalf("NewEngine: %v", err)
+	}
+
+	return e, n
+}
+
+func testVehicle(fuel float64) *connecteddrive.Vehicle {
+	v := &connecteddrive.Vehicle{Vin: "WBA00000000000001"}
+	v.Properties.FuelLevel = connecteddrive.Volume{Value: fuel, Units: "LITERS"}
+
+	return v
+}
+
+func TestEngineForAndCooldown(t *testing.T) {
+	type step struct {
+		after time.Duration
+		fuel  float64
+		fires bool
+	}
+
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		rule  Rule
+		steps []step
+	}{
+		{
+			name: "fires once per activation",
+			rule: Rule{Name: "low", When: "properties.fuelLevel.value < 10"},
+			steps: []step{
+				{0, 5, true},
+				{time.Minute, 5, false},
+				{2 * time.Minute, 20, false},
+				{3 * time.Minute, 5, true},
+			},
+		},
+		{
+			name: "waits for the condition to hold",
+			rule: Rule{Name: "low", When: "properties.fuelLevel.value < 10", For: Duration(10 * time.Minute)},
+			steps: []step{
+				{0, 5, false},
+				{9 * time.Minute, 5, false},
+				{10 * time.Minute, 5, true},
+				{11 * time.Minute, 20, false},
+				{12 * time.Minute, 5, false},
+				{21 * time.Minute, 5, false},
+				{22 * time.Minute, 5, true},
+			},
+		},
+		{
+			name: "repeats after the cooldown",
+			rule: Rule{Name: "low", When: "properties.fuelLevel.value < 10", Cooldown: Duration(time.Hour)},
+			steps: []step{
+				{0, 5, true},
+				{59 * time.Minute, 5, false},
+				{time.Hour, 5, true},
+				{90 * time.Minute, 5, false},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, n := newTestEngine(t, tt.rule)
+
+			for _, step := range tt.steps {
+				events, err := e.Evaluate(context.Background(), testVehicle(step.fuel), start.Add(step.after))
+				if err != nil {
+					t.Fatalf("Evaluate at %s: %v", step.after, err)
+				}
+				if fired := len(events) > 0; fired != step.fires {
+					t.Errorf("at %s with fuel %v: fired = %v, want %v", step.after, step.fuel, fired, step.fires)
+				}
+			}
+
+			if len(n.events) == 0 {
+				t.Errorf("notifier received no events")
+			}
+		})
+	}
+}
+
+func TestEngineFailingRuleDoesNotDropEvents(t *testing.T) {
+	e, n := newTestEngine(
+		t,
+		Rule{Name: "a", When: "true"},
+		Rule{Name: "b", When: "1 / properties.fuelLevel.value > 0"},
+	)
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	events, err := e.Evaluate(context.Background(), testVehicle(0), now)
+	var ruleErrors RuleErrors
+	if !errors.As(err, &ruleErrors) || ruleErrors["b"] == nil || len(ruleErrors) != 1 {
+		t.Fatalf("Evaluate error = %v, want an error of rule b only", err)
+	}
+	if len(events) != 1 || events[0].Data["rule"] != "a" {
+		t.Fatalf("events = %+v, want the event of rule a", events)
+	}
+	if len(n.events) != 1 {
+		t.Fatalf("notifier received %d events, want 1", len(n.events))
+	}
+}
+
+func TestEngineRetriesUndeliveredEvents(t *testing.T) {
+	e, n := newTestEngine(t, Rule{Name: "a", When: "true"})
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	n.err = errors.New("unavailable")
+	_, err := e.Evaluate(context.Background(), testVehicle(0), now)
+	if err == nil {
+		t.Fatalf("Evaluate succeeded with a failing notifier")
+	}
+
+	n.err = nil
+	events, err := e.Evaluate(context.Background(), testVehicle(0), now.Add(time.Minute))
+	if err != nil || len(events) != 1 || len(n.events) != 1 {
+		t.Fatalf("events = %d, delivered = %d, err = %v; want the event delivered on retry", len(events), len(n.events), err)
+	}
+
+	events, _ = e.Evaluate(context.Background(), testVehicle(0), now.Add(2*time.Minute))
+	if len(events) != 0 {
+		t.Fatalf("rule fired again after delivery")
+	}
+}
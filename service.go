@@ -0,0 +1,226 @@
+package connected_drive
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	icsProductId  = "-//sdrobov//connected-drive//EN"
+	icsDateFormat = "20060102"
+	icsTimeFormat = "20060102T150405Z"
+	icsLineLength = 75
+)
+
+type MileageReading struct {
+	At      time.Time `json:"at"`
+	Mileage Distance  `json:"mileage"`
+}
+
+type ServiceItem struct {
+	Type             string       `json:"type"`
+	Status           string       `json:"status"`
+	Title            string       `json:"title"`
+	Description      string       `json:"description"`
+	Criticalness     Criticalness `json:"criticalness"`
+	DueDate          time.Time    `json:"dueDate"`
+	DueDistance      *Distance    `json:"dueDistance,omitempty"`
+	EstimatedDueDate time.Time    `json:"estimatedDueDate"`
+}
+
+// NextDueDate returns the earlier of the date the service is due and the date the remaining distance
+// is estimated to be driven. It is zero when neither is known.
+func (i ServiceItem) NextDueDate() time.Time {
+	switch {
+	case i.DueDate.IsZero():
+		return i.EstimatedDueDate
+	case i.EstimatedDueDate.IsZero():
+		return i.DueDate
+	case i.EstimatedDueDate.Before(i.DueDate):
+		return i.EstimatedDueDate
+	}
+
+	return i.DueDate
+}
+
+type ServicePlan struct {
+	Vin         string        `json:"vin"`
+	Model       string        `json:"model"`
+	GeneratedAt time.Time     `json:"generatedAt"`
+	KmPerDay    float64       `json:"kmPerDay"`
+	Items       []ServiceItem `json:"items"`
+}
+
+// ServicePlan merges the service items of the vehicle properties with their display texts from the vehicle
+// status. Mileage history, if given, is used to estimate when distance-based items become due.
+func (v *Vehicle) ServicePlan(history []MileageReading) *ServicePlan {
+	now := v.Status.LastUpdatedAt
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	plan := &ServicePlan{
+		Vin:         v.Vin,
+		Model:       v.Model,
+		GeneratedAt: now,
+		KmPerDay:    kmPerDay(history),
+	}
+
+	for _, s := range v.Properties.ServiceRequired {
+		item := ServiceItem{
+			Type:        s.Type,
+			Status:      s.Status,
+			Title:       s.Type,
+			DueDate:     s.DateTime,
+			DueDistance: s.Distance,
+		}
+
+		for _, r := range v.Status.RequiredServices {
+			if strings.EqualFold(r.Id, s.Type) {
+				item.Title = firstNonEmpty(r.Title, item.Title)
+				item.Description = firstNonEmpty(r.LongDescription, r.Subtitle)
+				item.Criticalness = r.Criticalness
+
+				break
+			}
+		}
+
+		if s.Distance != nil && plan.KmPerDay > 0 {
+			days := s.Distance.Km() / plan.KmPerDay
+			item.EstimatedDueDate = now.Add(time.Duration(days * float64(24*time.Hour)))
+		}
+
+		plan.Items = append(plan.Items, item)
+	}
+
+	sort.SliceStable(plan.Items, func(i, j int) bool {
+		a, b := plan.Items[i].NextDueDate(), plan.Items[j].NextDueDate()
+		if a.IsZero() || b.IsZero() {
+			return !a.IsZero()
+		}
+
+		return a.Before(b)
+	})
+
+	return plan
+}
+
+// Upcoming returns the items due within the given period, overdue items included.
+func (p *ServicePlan) Upcoming(within time.Duration) []ServiceItem {
+	limit := p.GeneratedAt.Add(within)
+
+	var items []ServiceItem
+	for _, i := range p.Items {
+		due := i.NextDueDate()
+		if !due.IsZero() && !due.After(limit) {
+			items = append(items, i)
+		}
+	}
+
+	return items
+}
+
+// WriteICalendar exports the items with a known due date as all-day iCalendar events.
+func (p *ServicePlan) WriteICalendar(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	stamp := p.GeneratedAt.UTC().Format(icsTimeFormat)
+
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:" + icsProductId,
+		"CALSCALE:GREGORIAN",
+		"METHOD:PUBLISH",
+	}
+	for _, i := range p.Items {
+		due := i.NextDueDate()
+		if due.IsZero() {
+			continue
+		}
+
+		description := i.Description
+		if i.DueDistance != nil {
+			description = strings.TrimSpace(fmt.Sprintf(
+				"%s\nDue in %.0f %s",
+				description,
+				i.DueDistance.Value,
+				strings.ToLower(i.DueDistance.Units),
+			))
+		}
+
+		lines = append(
+			lines,
+			"BEGIN:VEVENT",
+			fmt.Sprintf("UID:%s-%s@connected-drive", p.Vin, i.Type),
+			"DTSTAMP:"+stamp,
+			"DTSTART;VALUE=DATE:"+due.Format(icsDateFormat),
+			"DTEND;VALUE=DATE:"+due.AddDate(0, 0, 1).Format(icsDateFormat),
+			"SUMMARY:"+icsEscape(fmt.Sprintf("%s %s: %s", p.Model, p.Vin, i.Title)),
+			"DESCRIPTION:"+icsEscape(description),
+			"CATEGORIES:SERVICE",
+			"END:VEVENT",
+		)
+	}
+	lines = append(lines, "END:VCALENDAR")
+
+	for _, l := range lines {
+		_, err := bw.WriteString(icsFold(l))
+		if err != nil {
+			return fmt.Errorf("WriteICalendar error: %w", err)
+		}
+	}
+
+	return bw.Flush()
+}
+
+func kmPerDay(history []MileageReading) float64 {
+	if len(history) < 2 {
+		return 0
+	}
+
+	readings := append([]MileageReading(nil), history...)
+	sort.Slice(readings, func(i, j int) bool {
+		return readings[i].At.Before(readings[j].At)
+	})
+
+	first, last := readings[0], readings[len(readings)-1]
+	days := last.At.Sub(first.At).Hours() / 24
+	distance := last.Mileage.Km() - first.Mileage.Km()
+	if days < 1 || distance <= 0 {
+		return 0
+	}
+
+	return distance / days
+}
+
+func icsEscape(s string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+	).Replace(s)
+}
+
+// icsFold splits content lines longer than 75 octets as required by RFC 5545, keeping UTF-8 sequences intact.
+func icsFold(line string) string {
+	var b strings.Builder
+	n := 0
+	for _, r := range line {
+		size := len(string(r))
+		if n+size > icsLineLength {
+			b.WriteString("\r\n ")
+			n = 1
+		}
+		b.WriteRune(r)
+		n += size
+	}
+	b.WriteString("\r\n")
+
+	return b.String()
+}
@@ -0,0 +1,76 @@
+package connected_drive
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testServiceVehicle(t *testing.T) *Vehicle {
+	t.Helper()
+
+	var v Vehicle
+	err := json.Unmarshal([]byte(`{
+		"vin": "WBA00000000000001",
+		"model": "i4",
+		"properties": {
+			"serviceRequired": [
+				{"type": "BRAKE_FLUID", "status": "OK", "dateTime": "2025-06-01T00:00:00Z"},
+				{"type": "OIL", "status": "OK", "distance": {"value": 3000, "units": "KILOMETERS"}}
+			]
+		},
+		"status": {"lastUpdatedAt": "2025-01-01T00:00:00Z"}
+	}`), &v)
+	if err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+
+	return &v
+}
+
+func TestServicePlanTimeOnlyItem(t *testing.T) {
+	history := []MileageReading{
+		{At: time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC), Mileage: Distance{Value: 10000, Units: "KILOMETERS"}},
+		{At: time.Date(2024, 12, 31, 0, 0, 0, 0, time.UTC), Mileage: Distance{Value: 11500, Units: "KILOMETERS"}},
+	}
+
+	for _, system := range []UnitSystem{UnitSystemAsReported, UnitSystemMetric, UnitSystemImperial, UnitSystemUS} {
+		v := testServiceVehicle(t)
+		v.NormalizeUnits(system)
+		plan := v.ServicePlan(history)
+
+		items := map[string]ServiceItem{}
+		for _, i := range plan.Items {
+			items[i.Type] = i
+		}
+
+		brake := items["BRAKE_FLUID"]
+		if brake.DueDistance != nil || !brake.EstimatedDueDate.IsZero() {
+			t.Errorf("system %d: time-only item got distance %v, estimate %v", system, brake.DueDistance, brake.EstimatedDueDate)
+		}
+		if want := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC); !brake.NextDueDate().Equal(want) {
+			t.Errorf("system %d: time-only item due %v, want %v", system, brake.NextDueDate(), want)
+		}
+
+		oil := items["OIL"]
+		if oil.DueDistance == nil {
+			t.Fatalf("system %d: distance-based item lost its distance", system)
+		}
+		// 3000 km at 50 km a day
+		want := time.Date(2025, 3, 2, 0, 0, 0, 0, time.UTC)
+		if d := oil.EstimatedDueDate.Sub(want); d > time.Hour || d < -time.Hour {
+			t.Errorf("system %d: distance-based item estimated %v, want %v", system, oil.EstimatedDueDate, want)
+		}
+
+		var b bytes.Buffer
+		err := plan.WriteICalendar(&b)
+		if err != nil {
+			t.Fatalf("WriteICalendar: %v", err)
+		}
+		if n := strings.Count(b.String(), "Due in"); n != 1 {
+			t.Errorf("system %d: %d events mention a distance, want 1:\n%s", system, n, b.String())
+		}
+	}
+}
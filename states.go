@@ -0,0 +1,191 @@
+package connected_drive
+
+import (
+	"strings"
+)
+
+type DoorState string
+
+const (
+	DoorStateClosed DoorState = "CLOSED"
+	DoorStateOpen   DoorState = "OPEN"
+)
+
+type WindowState string
+
+const (
+	WindowStateClosed       WindowState = "CLOSED"
+	WindowStateOpen         WindowState = "OPEN"
+	WindowStateIntermediate WindowState = "INTERMEDIATE"
+)
+
+type LockState string
+
+const (
+	LockStateLocked          LockState = "LOCKED"
+	LockStateSecured         LockState = "SECURED"
+	LockStateSelectiveLocked LockState = "SELECTIVE_LOCKED"
+	LockStatePartiallyLocked LockState = "PARTIALLY_LOCKED"
+	LockStateUnlocked        LockState = "UNLOCKED"
+)
+
+type Criticalness string
+
+const (
+	CriticalnessNonCritical  Criticalness = "nonCritical"
+	CriticalnessSemiCritical Criticalness = "semiCritical"
+	CriticalnessCritical     Criticalness = "critical"
+)
+
+var (
+	doorStates   = []string{string(DoorStateClosed), string(DoorStateOpen)}
+	windowStates = []string{string(WindowStateClosed), string(WindowStateOpen), string(WindowStateIntermediate)}
+	lockStates   = []string{
+		string(LockStateLocked),
+		string(LockStateSecured),
+		string(LockStateSelectiveLocked),
+		string(LockStatePartiallyLocked),
+		string(LockStateUnlocked),
+	}
+	criticalnesses = []string{
+		string(CriticalnessNonCritical),
+		string(CriticalnessSemiCritical),
+		string(CriticalnessCritical),
+	}
+)
+
+func (s *DoorState) UnmarshalJSON(b []byte) error {
+	*s = DoorState(unmarshalEnum(b, doorStates))
+
+	return nil
+}
+
+func (s DoorState) IsKnown() bool {
+	return isKnownEnum(string(s), doorStates)
+}
+
+func (s DoorState) IsOpen() bool {
+	return s == DoorStateOpen
+}
+
+func (s *WindowState) UnmarshalJSON(b []byte) error {
+	*s = WindowState(unmarshalEnum(b, windowStates))
+
+	return nil
+}
+
+func (s WindowState) IsKnown() bool {
+	return isKnownEnum(string(s), windowStates)
+}
+
+func (s WindowState) IsOpen() bool {
+	return s == WindowStateOpen || s == WindowStateIntermediate
+}
+
+func (s *LockState) UnmarshalJSON(b []byte) error {
+	*s = LockState(unmarshalEnum(b, lockStates))
+
+	return nil
+}
+
+func (s LockState) IsKnown() bool {
+	return isKnownEnum(string(s), lockStates)
+}
+
+func (s LockState) IsLocked() bool {
+	return s == LockStateLocked || s == LockStateSecured
+}
+
+func (c *Criticalness) UnmarshalJSON(b []byte) error {
+	*c = Criticalness(unmarshalEnum(b, criticalnesses))
+
+	return nil
+}
+
+func (c Criticalness) IsKnown() bool {
+	return isKnownEnum(string(c), criticalnesses)
+}
+
+// Level orders criticalness values: 0 for unknown, 1 for nonCritical and up to 3 for critical.
+func (c Criticalness) Level() int {
+	for i, known := range criticalnesses {
+		if string(c) == known {
+			return i + 1
+		}
+	}
+
+	return 0
+}
+
+// unmarshalEnum maps a JSON string case-insensitively onto one of the known values.
+// Unknown values are preserved as they were sent; values that aren't strings are kept as raw JSON, so an
+// unexpected value never fails decoding of the whole vehicle.
+func unmarshalEnum(b []byte, known []string) string {
+	raw := rawString(b)
+	trimmed := strings.TrimSpace(raw)
+	for _, k := range known {
+		if strings.EqualFold(trimmed, k) {
+			return k
+		}
+	}
+
+	return raw
+}
+
+func isKnownEnum(v string, known []string) bool {
+	for _, k := range known {
+		if v == k {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (v *Vehicle) OpenOpenings() []string {
+	dw := v.Properties.DoorsAndWindows
+	var openings []string
+
+	doors := []struct {
+		name  string
+		state DoorState
+	}{
+		{"driverFrontDoor", dw.Doors.DriverFront},
+		{"driverRearDoor", dw.Doors.DriverRear},
+		{"passengerFrontDoor", dw.Doors.PassengerFront},
+		{"passengerRearDoor", dw.Doors.PassengerRear},
+		{"trunk", dw.Trunk},
+		{"hood", dw.Hood},
+	}
+	for _, d := range doors {
+		if d.state.IsOpen() {
+			openings = append(openings, d.name)
+		}
+	}
+
+	windows := []struct {
+		name  string
+		state WindowState
+	}{
+		{"driverFrontWindow", dw.Windows.DriverFront},
+		{"driverRearWindow", dw.Windows.DriverRear},
+		{"passengerFrontWindow", dw.Windows.PassengerFront},
+		{"passengerRearWindow", dw.Windows.PassengerRear},
+	}
+	for _, w := range windows {
+		if w.state.IsOpen() {
+			openings = append(openings, w.name)
+		}
+	}
+
+	return openings
+}
+
+func (v *Vehicle) IsSecure() bool {
+	locked := v.Properties.AreDoorsLocked
+	if v.Status.DoorsGeneralState.IsKnown() {
+		locked = v.Status.DoorsGeneralState.IsLocked()
+	}
+
+	return locked && len(v.OpenOpenings()) == 0
+}
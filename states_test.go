@@ -0,0 +1,32 @@
+package connected_drive
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestUnmarshalEnumKeepsUnexpectedValues(t *testing.T) {
+	tests := []struct {
+		json  string
+		want  DoorState
+		known bool
+	}{
+		{`"open"`, DoorStateOpen, true},
+		{`" CLOSED "`, DoorStateClosed, true},
+		{`"AJAR"`, "AJAR", false},
+		{`null`, "", false},
+		{`2`, "2", false},
+		{`{"state":"OPEN"}`, `{"state":"OPEN"}`, false},
+	}
+
+	for _, tt := range tests {
+		var s DoorState
+		err := json.Unmarshal([]byte(tt.json), &s)
+		if err != nil {
+			t.Errorf("%s: %v", tt.json, err)
+		}
+		if s != tt.want || s.IsKnown() != tt.known {
+			t.Errorf("%s: got %q (known %v), want %q (known %v)", tt.json, s, s.IsKnown(), tt.want, tt.known)
+		}
+	}
+}
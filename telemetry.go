@@ -0,0 +1,163 @@
+package connected_drive
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"time"
+)
+
+// Metric names recorded through the Meter.
+const (
+	MetricOperationDuration = "connecteddrive.operation.duration"
+	MetricHttpDuration      = "connecteddrive.http.duration"
+	MetricAuthDuration      = "connecteddrive.auth.duration"
+	MetricErrors            = "connecteddrive.errors"
+)
+
+// Attribute keys set on spans and metrics.
+const (
+	AttrOperation  = "connecteddrive.operation"
+	AttrAuthStage  = "connecteddrive.auth.stage"
+	AttrVinHash    = "connecteddrive.vin_hash"
+	AttrRetryCount = "connecteddrive.retry_count"
+	AttrOutcome    = "connecteddrive.outcome"
+	AttrHttpMethod = "http.method"
+	AttrEndpoint   = "http.route"
+	AttrStatusCode = "http.status_code"
+)
+
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+func Attr(key string, value interface{}) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Span is the part of a trace span the client uses. An OpenTelemetry span satisfies it through a thin adapter.
+type Span interface {
+	SetAttributes(attrs ...Attribute)
+	RecordError(err error)
+	End()
+}
+
+// Tracer starts spans for the operations of the client, the stages of the login and every API request.
+// The returned context carries the span, so that nested spans become its children.
+type Tracer interface {
+	Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span)
+}
+
+// Meter records durations in seconds and counters under the Metric* names.
+type Meter interface {
+	RecordDuration(ctx context.Context, name string, duration time.Duration, attrs ...Attribute)
+	AddCount(ctx context.Context, name string, n int64, attrs ...Attribute)
+}
+
+func WithTracer(tracer Tracer) ClientOption {
+	return func(c *Client) {
+		c.tracer = tracer
+	}
+}
+
+func WithMeter(meter Meter) ClientOption {
+	return func(c *Client) {
+		c.meter = meter
+	}
+}
+
+// HashVin identifies a vehicle in telemetry without exposing its VIN.
+func HashVin(vin string) string {
+	sum := sha256.Sum256([]byte(vin))
+
+	return hex.EncodeToString(sum[:8])
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttributes(...Attribute) {}
+func (noopSpan) RecordError(error)          {}
+func (noopSpan) End()                       {}
+
+type noopTracer struct{}
+
+func (noopTracer) Start(ctx context.Context, _ string, _ ...Attribute) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+type noopMeter struct{}
+
+func (noopMeter) RecordDuration(context.Context, string, time.Duration, ...Attribute) {}
+func (noopMeter) AddCount(context.Context, string, int64, ...Attribute)               {}
+
+// instrumentation ends spans and records the metrics of one operation.
+type instrumentation struct {
+	tracer Tracer
+	meter  Meter
+}
+
+func newInstrumentation(tracer Tracer, meter Meter) instrumentation {
+	if tracer == nil {
+		tracer = noopTracer{}
+	}
+	if meter == nil {
+		meter = noopMeter{}
+	}
+
+	return instrumentation{tracer: tracer, meter: meter}
+}
+
+// operation is started with instrumentation.start and finished with end, typically deferred.
+type operation struct {
+	instrumentation
+	ctx    context.Context
+	span   Span
+	metric string
+	start  time.Time
+	attrs  []Attribute
+}
+
+func (i instrumentation) start(ctx context.Context, name string, metric string, attrs ...Attribute) (context.Context, *operation) {
+	ctx, span := i.tracer.Start(ctx, name, attrs...)
+
+	return ctx, &operation{
+		instrumentation: i,
+		ctx:             ctx,
+		span:            span,
+		metric:          metric,
+		start:           time.Now(),
+		attrs:           attrs,
+	}
+}
+
+func (o *operation) setAttributes(attrs ...Attribute) {
+	o.attrs = append(o.attrs, attrs...)
+	o.span.SetAttributes(attrs...)
+}
+
+func (o *operation) end(err error) {
+	outcome := "success"
+	if err != nil {
+		outcome = "error"
+		o.span.RecordError(err)
+		o.meter.AddCount(o.ctx, MetricErrors, 1, o.attrs...)
+	}
+	o.span.SetAttributes(Attr(AttrOutcome, outcome))
+	o.span.End()
+
+	o.meter.RecordDuration(o.ctx, o.metric, time.Since(o.start), append(o.attrs, Attr(AttrOutcome, outcome))...)
+}
+
+// endpoint is the URL of a request without its query and with VINs replaced, so that it can be used to group
+// requests in metrics.
+func endpoint(req *http.Request) string {
+	return vinPattern.ReplaceAllString(logUrl(req.URL), "{vin}")
+}
+
+func (c *Client) startOperation(ctx context.Context, name string, attrs ...Attribute) (context.Context, *operation) {
+	attrs = append([]Attribute{Attr(AttrOperation, name)}, attrs...)
+
+	return newInstrumentation(c.tracer, c.meter).start(ctx, "connecteddrive."+name, MetricOperationDuration, attrs...)
+}
@@ -0,0 +1,110 @@
+package connected_drive
+
+import "time"
+
+type WheelPosition string
+
+const (
+	WheelFrontLeft  WheelPosition = "frontLeft"
+	WheelFrontRight WheelPosition = "frontRight"
+	WheelRearLeft   WheelPosition = "rearLeft"
+	WheelRearRight  WheelPosition = "rearRight"
+)
+
+type TireSeason int
+
+const (
+	TireSeasonUnknown TireSeason = iota
+	TireSeasonSummer
+	TireSeasonWinter
+	TireSeasonAllSeason
+)
+
+func (s TireSeason) String() string {
+	switch s {
+	case TireSeasonSummer:
+		return "SUMMER"
+	case TireSeasonWinter:
+		return "WINTER"
+	case TireSeasonAllSeason:
+		return "ALL_SEASON"
+	}
+
+	return "UNKNOWN"
+}
+
+type TireGuardWarning struct {
+	Type        string    `json:"type"`
+	Severity    Severity  `json:"severity"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	Timestamp   time.Time `json:"dateTime"`
+}
+
+// Tire pressures are reported in kPa and temperatures in °C.
+type Tire struct {
+	Status struct {
+		CurrentPressure float64 `json:"currentPressure"`
+		TargetPressure  float64 `json:"targetPressure"`
+		PressureStatus  int     `json:"pressureStatus"`
+		WearStatus      int     `json:"wearStatus"`
+		Temperature     float64 `json:"temperature"`
+	} `json:"status"`
+	Details struct {
+		Dimension            string     `json:"dimension"`
+		TreadDesign          string     `json:"treadDesign"`
+		Manufacturer         string     `json:"manufacturer"`
+		ManufacturingWeek    int        `json:"manufacturingWeek"`
+		IsOptimizedForOemBmw bool       `json:"isOptimizedForOemBmw"`
+		PartNumber           string     `json:"partNumber"`
+		MountingDate         time.Time  `json:"mountingDate"`
+		Season               TireSeason `json:"season"`
+	} `json:"details"`
+}
+
+func (t Tire) HasPressure() bool {
+	return t.Status.CurrentPressure > 0 && t.Status.TargetPressure > 0
+}
+
+// IsUnderInflated reports whether the pressure is more than tolerance (a fraction, e.g. 0.1 for 10%) below target.
+func (t Tire) IsUnderInflated(tolerance float64) bool {
+	if !t.HasPressure() {
+		return false
+	}
+
+	return t.Status.CurrentPressure < t.Status.TargetPressure*(1-tolerance)
+}
+
+type Tires struct {
+	FrontLeft         Tire               `json:"frontLeft"`
+	FrontRight        Tire               `json:"frontRight"`
+	RearLeft          Tire               `json:"rearLeft"`
+	RearRight         Tire               `json:"rearRight"`
+	TireGuardWarnings []TireGuardWarning `json:"tireGuardWarnings"`
+}
+
+func (t Tires) Wheel(position WheelPosition) Tire {
+	switch position {
+	case WheelFrontLeft:
+		return t.FrontLeft
+	case WheelFrontRight:
+		return t.FrontRight
+	case WheelRearLeft:
+		return t.RearLeft
+	case WheelRearRight:
+		return t.RearRight
+	}
+
+	return Tire{}
+}
+
+func (t Tires) UnderInflated(tolerance float64) []WheelPosition {
+	var wheels []WheelPosition
+	for _, position := range []WheelPosition{WheelFrontLeft, WheelFrontRight, WheelRearLeft, WheelRearRight} {
+		if t.Wheel(position).IsUnderInflated(tolerance) {
+			wheels = append(wheels, position)
+		}
+	}
+
+	return wheels
+}
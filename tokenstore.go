@@ -0,0 +1,140 @@
+package connected_drive
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+)
+
+var ErrTokenStoreNotDeletable = errors.New("token store does not support deletion")
+
+// TokenStore persists the tokens of a client between runs. Load returns a nil token when nothing is stored.
+type TokenStore interface {
+	Load() (*Token, error)
+	Save(token *Token) error
+	Delete() error
+}
+
+func WithTokenStore(store TokenStore) ClientOption {
+	return func(c *Client) {
+		c.authStore = store
+	}
+}
+
+// readWriterTokenStore adapts the io.ReadWriter passed to NewClient. Deletion works for writers that
+// can be truncated or reset, such as *bytes.Buffer and *os.File. Saving truncates before writing and is not
+// atomic; use a FileTokenStore for that.
+type readWriterTokenStore struct {
+	rw io.ReadWriter
+}
+
+func newReadWriterTokenStore(rw io.ReadWriter) TokenStore {
+	return &readWriterTokenStore{rw: rw}
+}
+
+func (s *readWriterTokenStore) Load() (*Token, error) {
+	if seeker, ok := s.rw.(io.Seeker); ok {
+		_, err := seeker.Seek(0, io.SeekStart)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var token *Token
+	err := json.NewDecoder(s.rw).Decode(&token)
+	if err == io.EOF {
+		return nil, nil
+	}
+
+	return token, err
+}
+
+// Save replaces the stored token when the writer can be truncated or reset, otherwise the token is appended.
+func (s *readWriterTokenStore) Save(token *Token) error {
+	err := s.Delete()
+	if err != nil && !errors.Is(err, ErrTokenStoreNotDeletable) {
+		return err
+	}
+
+	err = json.NewEncoder(s.rw).Encode(token)
+	if err != nil {
+		return err
+	}
+
+	if syncer, ok := s.rw.(interface{ Sync() error }); ok {
+		return syncer.Sync()
+	}
+
+	return nil
+}
+
+func (s *readWriterTokenStore) Delete() error {
+	switch rw := s.rw.(type) {
+	case interface{ Reset() }:
+		rw.Reset()
+
+		return nil
+	case interface{ Truncate(size int64) error }:
+		err := rw.Truncate(0)
+		if err != nil {
+			return err
+		}
+
+		if seeker, ok := s.rw.(io.Seeker); ok {
+			_, err = seeker.Seek(0, io.SeekStart)
+		}
+
+		return err
+	}
+
+	return ErrTokenStoreNotDeletable
+}
+
+// FileTokenStore keeps the tokens in a JSON file. Saving replaces the file atomically, so a crash while
+// the refresh token is rotated leaves either the old or the new token on disk.
+type FileTokenStore struct {
+	Path string
+}
+
+func NewFileTokenStore(path string) *FileTokenStore {
+	return &FileTokenStore{Path: path}
+}
+
+func (s *FileTokenStore) Load() (*Token, error) {
+	data, err := os.ReadFile(s.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// files written by older versions may hold several tokens, the first one is used like before
+	var token *Token
+	err = json.NewDecoder(bytes.NewReader(data)).Decode(&token)
+	if err == io.EOF {
+		return nil, nil
+	}
+
+	return token, err
+}
+
+func (s *FileTokenStore) Save(token *Token) error {
+	data, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(s.Path, data, 0o600)
+}
+
+func (s *FileTokenStore) Delete() error {
+	err := os.Remove(s.Path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,49 @@
+package connected_drive
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadWriterTokenStoreUsesFileHandle(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	defer f.Close()
+
+	// the handle keeps working after the path is gone
+	err = os.Remove(path)
+	if err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+
+	store := newReadWriterTokenStore(f)
+	token, err := store.Load()
+	if err != nil || token != nil {
+		t.Fatalf("Load of an empty file: %v, %v", token, err)
+	}
+
+	for _, refresh := range []string{"first-refresh-token-which-is-long", "second"} {
+		err = store.Save(&Token{AccessToken: "access", RefreshToken: refresh})
+		if err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+
+		token, err = store.Load()
+		if err != nil || token == nil || token.RefreshToken != refresh {
+			t.Fatalf("Load after saving %q: %+v, %v", refresh, token, err)
+		}
+	}
+
+	err = store.Delete()
+	if err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	token, err = store.Load()
+	if err != nil || token != nil {
+		t.Errorf("Load after Delete: %+v, %v", token, err)
+	}
+}
@@ -0,0 +1,222 @@
+package connected_drive
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+)
+
+const tripsRequestUrl = "https://cocoapi.bmwgroup.com/eadrax-suscs/v1/vehicles/trips?startDate=%s&endDate=%s"
+
+type TripLocation struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Formatted string  `json:"formatted"`
+}
+
+type Consumption struct {
+	Value float64 `json:"value"`
+	Units string  `json:"units"`
+}
+
+type Trip struct {
+	Id                 string       `json:"id"`
+	StartTime          time.Time    `json:"startTime"`
+	EndTime            time.Time    `json:"endTime"`
+	StartLocation      TripLocation `json:"startLocation"`
+	EndLocation        TripLocation `json:"endLocation"`
+	StartMileage       Distance     `json:"startMileage"`
+	EndMileage         Distance     `json:"endMileage"`
+	Distance           Distance     `json:"distance"`
+	DurationSeconds    int64        `json:"duration"`
+	AverageConsumption Consumption  `json:"averageConsumption"`
+	ElectricShare      float64      `json:"electricShare"`
+	EfficiencyScore    float64      `json:"efficiencyScore"`
+}
+
+func (t *Trip) Duration() time.Duration {
+	if t.DurationSeconds > 0 {
+		return time.Duration(t.DurationSeconds) * time.Second
+	}
+
+	return t.EndTime.Sub(t.StartTime)
+}
+
+type Trips []*Trip
+
+type TripPeriod int
+
+const (
+	TripPeriodDay TripPeriod = iota
+	TripPeriodWeek
+	TripPeriodMonth
+)
+
+type TripTotals struct {
+	PeriodStart        time.Time     `json:"periodStart"`
+	Trips              int           `json:"trips"`
+	DistanceKm         float64       `json:"distanceKm"`
+	Duration           time.Duration `json:"duration"`
+	AverageConsumption Consumption   `json:"averageConsumption"`
+	ElectricShare      float64       `json:"electricShare"`
+	EfficiencyScore    float64       `json:"efficiencyScore"`
+}
+
+func (c *Client) GetTrips(ctx context.Context, vin string, from time.Time, to time.Time) (trips Trips, err error) {
+	ctx, op := c.startOperation(ctx, "GetTrips", Attr(AttrVinHash, HashVin(vin)))
+	defer func() { op.end(err) }()
+
+	err = c.refreshAuth(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error refreshing auth while fetching trips: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodGet,
+		fmt.Sprintf(
+			tripsRequestUrl,
+			url.QueryEscape(from.UTC().Format(time.RFC3339)),
+			url.QueryEscape(to.UTC().Format(time.RFC3339)),
+		),
+		nil,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error creating trips request: %w", err)
+	}
+
+	req.Header = c.apiHeader()
+	req.Header.Set("bmw-vin", vin)
+
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching trips: %w", err)
+	}
+
+	defer func(body io.ReadCloser) {
+		_ = body.Close()
+	}(resp.Body)
+
+	var tripsResponse struct {
+		Trips Trips `json:"trips"`
+	}
+	d := json.NewDecoder(resp.Body)
+	err = d.Decode(&tripsResponse)
+	if err != nil || resp.StatusCode >= http.StatusBadRequest {
+		return nil, fmt.Errorf("error decoding trips: %w, %v", err, resp)
+	}
+
+	for _, t := range tripsResponse.Trips {
+		t.StartMileage = t.StartMileage.In(c.unitSystem)
+		t.EndMileage = t.EndMileage.In(c.unitSystem)
+		t.Distance = t.Distance.In(c.unitSystem)
+	}
+
+	return tripsResponse.Trips, nil
+}
+
+func (ts Trips) TotalsByDay(loc *time.Location) []TripTotals {
+	return ts.Totals(TripPeriodDay, loc)
+}
+
+func (ts Trips) TotalsByWeek(loc *time.Location) []TripTotals {
+	return ts.Totals(TripPeriodWeek, loc)
+}
+
+func (ts Trips) TotalsByMonth(loc *time.Location) []TripTotals {
+	return ts.Totals(TripPeriodMonth, loc)
+}
+
+// Totals groups trips by the period they started in. Weeks start on Monday. Consumption, electric share and
+// efficiency score are averaged weighted by distance; consumption only over trips in the same units as the first.
+func (ts Trips) Totals(period TripPeriod, loc *time.Location) []TripTotals {
+	if loc == nil {
+		loc = time.Local
+	}
+
+	type accumulator struct {
+		totals            TripTotals
+		consumptionKm     float64
+		consumption       float64
+		electricShare     float64
+		efficiencyScoreKm float64
+		efficiencyScore   float64
+	}
+
+	byPeriod := make(map[time.Time]*accumulator)
+	for _, t := range ts {
+		if t == nil {
+			continue
+		}
+
+		start := periodStart(t.StartTime.In(loc), period)
+		a, ok := byPeriod[start]
+		if !ok {
+			a = &accumulator{totals: TripTotals{PeriodStart: start}}
+			byPeriod[start] = a
+		}
+
+		km := t.Distance.Km()
+		a.totals.Trips++
+		a.totals.DistanceKm += km
+		a.totals.Duration += t.Duration()
+		a.electricShare += t.ElectricShare * km
+
+		if t.EfficiencyScore > 0 {
+			a.efficiencyScoreKm += km
+			a.efficiencyScore += t.EfficiencyScore * km
+		}
+
+		if t.AverageConsumption.Units != "" {
+			if a.totals.AverageConsumption.Units == "" {
+				a.totals.AverageConsumption.Units = t.AverageConsumption.Units
+			}
+			if a.totals.AverageConsumption.Units == t.AverageConsumption.Units {
+				a.consumptionKm += km
+				a.consumption += t.AverageConsumption.Value * km
+			}
+		}
+	}
+
+	totals := make([]TripTotals, 0, len(byPeriod))
+	for _, a := range byPeriod {
+		if a.consumptionKm > 0 {
+			a.totals.AverageConsumption.Value = round(a.consumption / a.consumptionKm)
+		}
+		if a.totals.DistanceKm > 0 {
+			a.totals.ElectricShare = round(a.electricShare / a.totals.DistanceKm)
+		}
+		if a.efficiencyScoreKm > 0 {
+			a.totals.EfficiencyScore = round(a.efficiencyScore / a.efficiencyScoreKm)
+		}
+		a.totals.DistanceKm = round(a.totals.DistanceKm)
+
+		totals = append(totals, a.totals)
+	}
+
+	sort.Slice(totals, func(i, j int) bool {
+		return totals[i].PeriodStart.Before(totals[j].PeriodStart)
+	})
+
+	return totals
+}
+
+func periodStart(t time.Time, period TripPeriod) time.Time {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+
+	switch period {
+	case TripPeriodWeek:
+		offset := (int(day.Weekday()) + 6) % 7
+
+		return day.AddDate(0, 0, -offset)
+	case TripPeriodMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+	}
+
+	return day
+}
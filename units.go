@@ -0,0 +1,235 @@
+package connected_drive
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	kmPerMile          = 1.609344
+	litersPerGallon    = 3.785411784
+	litersPerImpGallon = 4.54609
+)
+
+type DistanceUnit string
+
+const (
+	UnitKilometers DistanceUnit = "KILOMETERS"
+	UnitMiles      DistanceUnit = "MILES"
+)
+
+type VolumeUnit string
+
+const (
+	UnitLiters          VolumeUnit = "LITERS"
+	UnitGallons         VolumeUnit = "GALLONS"
+	UnitImperialGallons VolumeUnit = "IMPERIAL_GALLONS"
+	UnitPercent         VolumeUnit = "PERCENT"
+)
+
+type UnitSystem int
+
+const (
+	UnitSystemAsReported UnitSystem = iota
+	UnitSystemMetric
+	// UnitSystemImperial uses miles and imperial gallons, as in the UK.
+	UnitSystemImperial
+	// UnitSystemUS uses miles and US gallons.
+	UnitSystemUS
+)
+
+func ParseDistanceUnit(units string) DistanceUnit {
+	switch strings.ToUpper(strings.TrimSpace(units)) {
+	case "KILOMETERS", "KILOMETRES", "KILOMETER", "KILOMETRE", "KM":
+		return UnitKilometers
+	case "MILES", "MILE", "MI":
+		return UnitMiles
+	}
+
+	return DistanceUnit(units)
+}
+
+func ParseVolumeUnit(units string) VolumeUnit {
+	switch strings.ToUpper(strings.TrimSpace(units)) {
+	case "LITERS", "LITRES", "LITER", "LITRE", "L":
+		return UnitLiters
+	case "GALLONS", "GALLON", "GAL", "US_GALLONS":
+		return UnitGallons
+	case "IMPERIAL_GALLONS", "IMPERIAL_GALLON", "UK_GALLONS", "GAL_UK":
+		return UnitImperialGallons
+	case "PERCENT", "%":
+		return UnitPercent
+	}
+
+	return VolumeUnit(units)
+}
+
+type Distance struct {
+	Value float64 `json:"value"`
+	Units string  `json:"units"`
+}
+
+func (d Distance) Unit() DistanceUnit {
+	return ParseDistanceUnit(d.Units)
+}
+
+// Km returns the distance in kilometers. Values with unknown units are assumed to be kilometers.
+func (d Distance) Km() float64 {
+	if d.Unit() == UnitMiles {
+		return d.Value * kmPerMile
+	}
+
+	return d.Value
+}
+
+func (d Distance) Miles() float64 {
+	if d.Unit() == UnitMiles {
+		return d.Value
+	}
+
+	return d.Value / kmPerMile
+}
+
+// In converts the distance into the units of the given system. A distance without units is returned as is.
+func (d Distance) In(system UnitSystem) Distance {
+	if d.Units == "" {
+		return d
+	}
+
+	switch system {
+	case UnitSystemMetric:
+		return Distance{Value: round(d.Km()), Units: string(UnitKilometers)}
+	case UnitSystemImperial, UnitSystemUS:
+		return Distance{Value: round(d.Miles()), Units: string(UnitMiles)}
+	}
+
+	return d
+}
+
+type Volume struct {
+	Value float64 `json:"value"`
+	Units string  `json:"units"`
+}
+
+func (v Volume) Unit() VolumeUnit {
+	return ParseVolumeUnit(v.Units)
+}
+
+func (v Volume) IsPercent() bool {
+	return v.Unit() == UnitPercent
+}
+
+// Liters returns the volume in liters, or 0 for level readings reported in percent.
+// Values with unknown units are assumed to be liters.
+func (v Volume) Liters() float64 {
+	switch v.Unit() {
+	case UnitPercent:
+		return 0
+	case UnitGallons:
+		return v.Value * litersPerGallon
+	case UnitImperialGallons:
+		return v.Value * litersPerImpGallon
+	}
+
+	return v.Value
+}
+
+// Gallons returns the volume in US gallons, or 0 for level readings reported in percent.
+func (v Volume) Gallons() float64 {
+	return v.Liters() / litersPerGallon
+}
+
+func (v Volume) ImperialGallons() float64 {
+	return v.Liters() / litersPerImpGallon
+}
+
+func (v Volume) In(system UnitSystem) Volume {
+	if v.Units == "" || v.IsPercent() {
+		return v
+	}
+
+	switch system {
+	case UnitSystemMetric:
+		return Volume{Value: round(v.Liters()), Units: string(UnitLiters)}
+	case UnitSystemImperial:
+		return Volume{Value: round(v.ImperialGallons()), Units: string(UnitImperialGallons)}
+	case UnitSystemUS:
+		return Volume{Value: round(v.Gallons()), Units: string(UnitGallons)}
+	}
+
+	return v
+}
+
+type Mileage struct {
+	Mileage          float64 `json:"mileage"`
+	Units            string  `json:"units"`
+	FormattedMileage string  `json:"formattedMileage"`
+}
+
+func (m Mileage) Distance() Distance {
+	return Distance{Value: m.Mileage, Units: m.Units}
+}
+
+func (m Mileage) In(system UnitSystem) Mileage {
+	if m.Units == "" {
+		return m
+	}
+
+	var units string
+	switch system {
+	case UnitSystemMetric:
+		units = "km"
+	case UnitSystemImperial, UnitSystemUS:
+		units = "mi"
+	default:
+		return m
+	}
+
+	mileage := m.Distance().In(system).Value
+
+	return Mileage{
+		Mileage:          mileage,
+		Units:            units,
+		FormattedMileage: formatMileage(mileage),
+	}
+}
+
+// formatMileage formats whole units with thousands separators, like the API does: 12,345.
+func formatMileage(mileage float64) string {
+	digits := strconv.FormatInt(int64(math.Round(mileage)), 10)
+	sign := ""
+	if strings.HasPrefix(digits, "-") {
+		sign, digits = "-", digits[1:]
+	}
+
+	var b strings.Builder
+	for i, d := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(d)
+	}
+
+	return sign + b.String()
+}
+
+func (v *Vehicle) NormalizeUnits(system UnitSystem) {
+	if system == UnitSystemAsReported {
+		return
+	}
+
+	v.Properties.FuelLevel = v.Properties.FuelLevel.In(system)
+	v.Properties.CombustionRange.Distance = v.Properties.CombustionRange.Distance.In(system)
+	for i, s := range v.Properties.ServiceRequired {
+		if s.Distance != nil {
+			d := s.Distance.In(system)
+			v.Properties.ServiceRequired[i].Distance = &d
+		}
+	}
+	v.Status.CurrentMileage = v.Status.CurrentMileage.In(system)
+}
+
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}